@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"dfstore"
+
+	"github.com/go-gota/gota/dataframe"
+	"github.com/go-gota/gota/series"
+)
+
+func runWrite(ctx context.Context, args []string) error {
+	var sf storeFlags
+	fs := newFlagSet("write", &sf)
+	mode := fs.String("mode", "append", "write mode: append, upsert, replace-table or error-if-exists")
+	keys := fs.String("keys", "", "comma separated key columns of upsert, the first column by default")
+	batch := fs.Int("batch", 0, "rows per batch, dfstore.DefaultBatchSize when 0")
+	copyRows := fs.Bool("copy", false, "load postgres tables with COPY")
+	var dialect csvFlags
+	dialect.register(fs)
+	lazyQuotes := fs.Bool("lazy-quotes", false, "accept quotes in unquoted fields and unescaped quotes in quoted fields")
+	typeList := fs.String("types", "", "comma separated column types, such as year=int")
+	jsonInput := fs.Bool("json", false, "the file holds JSON objects, in an array or one per line, instead of CSV")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError("expected one file")
+	}
+	m, err := dfstore.ParseWriteMode(*mode)
+	if err != nil {
+		return usageError(err.Error())
+	}
+	opts, err := dialect.options()
+	if err != nil {
+		return err
+	}
+	if opts.Types, err = parseTypes(*typeList); err != nil {
+		return err
+	}
+	opts.LazyQuotes = *lazyQuotes
+	opts.Write = dfstore.WriteOptions{Mode: m, Keys: splitList(*keys), BatchSize: *batch, Copy: *copyRows}
+	var r io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ctx, cancel := sf.withTimeout(ctx)
+	defer cancel()
+	dfs, err := sf.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer dfs.Close()
+	var n int
+	if *jsonInput {
+		n, err = dfs.WriteJSON(ctx, r, "", dfstore.JSONOptions{Types: opts.Types, Write: opts.Write})
+	} else {
+		n, err = dfs.ImportCSV(ctx, r, "", opts)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", fs.Arg(0), err)
+	}
+	fmt.Fprintf(stdout, "wrote %d rows to %s\n", n, dfs.TableName)
+	return nil
+}
+
+func runExport(ctx context.Context, args []string) error {
+	var sf storeFlags
+	fs := newFlagSet("export", &sf)
+	var dialect csvFlags
+	dialect.register(fs)
+	quoteAll := fs.Bool("quote-all", false, "quote every field")
+	crlf := fs.Bool("crlf", false, "end the lines with \\r\\n")
+	output := fs.String("o", "-", "output file, - for stdout")
+	jsonOutput := fs.Bool("json", false, "write JSON objects, one per line, instead of CSV")
+	var filters filterFlags
+	fs.Var(&filters, "filter", `row filter such as "year >= 2018", may be repeated`)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError("unexpected arguments")
+	}
+	opts, err := dialect.options()
+	if err != nil {
+		return err
+	}
+	opts.QuoteAll, opts.UseCRLF = *quoteAll, *crlf
+
+	ctx, cancel := sf.withTimeout(ctx)
+	defer cancel()
+	dfs, err := sf.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer dfs.Close()
+	w := stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	var n int
+	if *jsonOutput {
+		n, err = dfs.ReadJSON(ctx, w, "", filters, dfstore.JSONOptions{Columns: opts.Columns})
+	} else {
+		n, err = dfs.ExportCSV(ctx, w, "", filters, opts)
+	}
+	if err != nil {
+		return err
+	}
+	if *output != "-" {
+		fmt.Fprintf(stdout, "exported %d rows of %s to %s\n", n, dfs.TableName, *output)
+	}
+	return nil
+}
+
+// csvFlags are the flags of the CSV dialect shared by write and export.
+type csvFlags struct {
+	delimiter string
+	header    bool
+	columns   string
+	null      string
+}
+
+func (cf *csvFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&cf.delimiter, "delimiter", ",", "field delimiter of the CSV file")
+	fs.BoolVar(&cf.header, "header", true, "the CSV file starts with a header row")
+	fs.StringVar(&cf.columns, "columns", "", "comma separated columns, the header row or all the columns by default")
+	fs.StringVar(&cf.null, "null", "", "field value standing for a missing value, such as NULL")
+}
+
+// options returns the CSV options of the flags.
+func (cf csvFlags) options() (dfstore.CSVOptions, error) {
+	comma, n := utf8.DecodeRuneInString(cf.delimiter)
+	if n == 0 || n != len(cf.delimiter) {
+		return dfstore.CSVOptions{}, usageError("the delimiter must be a single character")
+	}
+	return dfstore.CSVOptions{Comma: comma, NoHeader: !cf.header, Columns: splitList(cf.columns), Null: cf.null}, nil
+}
+
+func runRead(ctx context.Context, args []string) error {
+	var sf storeFlags
+	fs := newFlagSet("read", &sf)
+	where := fs.String("where", "", `condition in the query string syntax, such as '[[year]] != {"2018"}' (mongodb only)`)
+	columnList := fs.String("columns", "", "comma separated columns, all the columns by default")
+	asList := fs.String("as", "", "comma separated names of the columns in the output")
+	limit := fs.Int("limit", 100, "maximum number of rows")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError("unexpected arguments")
+	}
+	columns, as := splitList(*columnList), splitList(*asList)
+	if len(as) > 0 && len(as) != len(columns) {
+		return usageError("-as needs a name for each column of -columns")
+	}
+
+	ctx, cancel := sf.withTimeout(ctx)
+	defer cancel()
+	dfs, err := sf.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer dfs.Close()
+	if err := checkWhere(dfs, *where); err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		schema, err := dfs.DescribeTable(ctx, "")
+		if err != nil {
+			return err
+		}
+		columns = schema.Columns
+	}
+	if len(as) == 0 {
+		as = columns
+	}
+	var res [][]string
+	if *where != "" {
+		res, err = dfs.ReadRecordsString(ctx, columns, as, *where, *limit)
+	} else {
+		filters := make([]dataframe.F, len(columns))
+		for i, col := range columns {
+			filters[i] = dataframe.F{Colname: col}
+		}
+		res, err = dfs.ReadRecords(ctx, filters, *limit)
+		if err == nil && len(res) > 0 {
+			res[0] = as
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return sf.print(res)
+}
+
+func runSchema(ctx context.Context, args []string) error {
+	var sf storeFlags
+	fs := newFlagSet("schema", &sf)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return usageError("expected at most one table")
+	}
+	ctx, cancel := sf.withTimeout(ctx)
+	defer cancel()
+	dfs, err := sf.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer dfs.Close()
+	schema, err := dfs.DescribeTable(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return sf.print(schemaRecords(schema))
+}
+
+// schemaRecords lists the columns of a table with the indexes covering them.
+func schemaRecords(schema dfstore.TableSchema) [][]string {
+	records := [][]string{{"column", "indexes"}}
+	for _, col := range schema.Columns {
+		var indexes []string
+		for _, spec := range schema.Indexes {
+			for _, c := range spec.Columns {
+				if c == col {
+					name := spec.Name
+					if spec.Unique {
+						name += " (unique)"
+					}
+					indexes = append(indexes, name)
+				}
+			}
+		}
+		records = append(records, []string{col, strings.Join(indexes, ", ")})
+	}
+	return records
+}
+
+func runTables(ctx context.Context, args []string) error {
+	var sf storeFlags
+	fs := newFlagSet("tables", &sf)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError("unexpected arguments")
+	}
+	ctx, cancel := sf.withTimeout(ctx)
+	defer cancel()
+	dfs, err := sf.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer dfs.Close()
+	tables, err := dfs.ListTables(ctx)
+	if err != nil {
+		return err
+	}
+	records := [][]string{{"table"}}
+	for _, table := range tables {
+		records = append(records, []string{table})
+	}
+	return sf.print(records)
+}
+
+func runDrop(ctx context.Context, args []string) error {
+	var sf storeFlags
+	fs := newFlagSet("drop", &sf)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	// the table is required so that the table of the profile is not dropped by mistake
+	if fs.NArg() != 1 || fs.Arg(0) == "" {
+		return usageError("expected one table")
+	}
+	ctx, cancel := sf.withTimeout(ctx)
+	defer cancel()
+	dfs, err := sf.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer dfs.Close()
+	if err := dfs.DropTable(ctx, fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "dropped %s\n", fs.Arg(0))
+	return nil
+}
+
+// splitList splits a comma separated list, returning nil for an empty list.
+func splitList(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	items := strings.Split(s, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+func runCopy(ctx context.Context, args []string) error {
+	var sf storeFlags
+	fs := newFlagSet("copy", &sf)
+	from := fs.String("from", "", "source profile, or URL when it contains ://")
+	to := fs.String("to", "", "destination profile, or URL when it contains ://")
+	toTable := fs.String("to-table", "", "destination table, the source table by default")
+	columnList := fs.String("columns", "", "comma separated columns, all the columns by default")
+	rename := fs.String("rename", "", "comma separated renamed columns, such as old=new")
+	typeList := fs.String("types", "", "comma separated destination column types, such as year=int")
+	mode := fs.String("mode", "upsert", "write mode: append, upsert, replace-table or error-if-exists")
+	keys := fs.String("keys", "", "comma separated key columns of upsert, the first column by default")
+	batch := fs.Int("batch", 0, "rows per batch, dfstore.DefaultBatchSize when 0")
+	checkpoint := fs.String("checkpoint", "", "file keeping the position of the copy, to resume it")
+	var filters filterFlags
+	fs.Var(&filters, "filter", `row filter such as "year >= 2018", may be repeated`)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError("unexpected arguments")
+	}
+	if *from == "" || *to == "" {
+		return usageError("-from and -to are required")
+	}
+	m, err := dfstore.ParseWriteMode(*mode)
+	if err != nil {
+		return usageError(err.Error())
+	}
+	renamed, err := splitPairs(*rename)
+	if err != nil {
+		return usageError("-rename: " + err.Error())
+	}
+	types, err := parseTypes(*typeList)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := sf.withTimeout(ctx)
+	defer cancel()
+	src, err := storeAt(sf, *from).open(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := storeAt(sf, *to).open(ctx)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	opts := dfstore.CopyOptions{
+		Columns:    splitList(*columnList),
+		Filters:    filters,
+		Rename:     renamed,
+		Types:      types,
+		Mode:       m,
+		Keys:       splitList(*keys),
+		BatchSize:  *batch,
+		DestTable:  *toTable,
+		Checkpoint: *checkpoint,
+		Progress: func(p dfstore.CopyProgress) {
+			fmt.Fprintf(os.Stderr, "copied %d rows\n", p.Rows)
+		},
+	}
+	n, err := dfstore.Copy(ctx, src, dst, "", opts)
+	if err != nil {
+		if *checkpoint != "" {
+			fmt.Fprintf(os.Stderr, "run the command again to resume the copy from %s\n", *checkpoint)
+		}
+		return err
+	}
+	table := dst.TableName
+	if *toTable != "" {
+		table = *toTable
+	}
+	fmt.Fprintf(stdout, "copied %d rows from %s to %s\n", n, src.TableName, table)
+	return nil
+}
+
+// storeAt returns the store flags selecting a profile, or a URL when it contains ://.
+func storeAt(sf storeFlags, name string) storeFlags {
+	sf.profile, sf.url = name, ""
+	if strings.Contains(name, "://") {
+		sf.url = name
+	}
+	return sf
+}
+
+// splitPairs splits a comma separated list of name=value pairs.
+func splitPairs(s string) (map[string]string, error) {
+	items := splitList(s)
+	if items == nil {
+		return nil, nil
+	}
+	pairs := make(map[string]string, len(items))
+	for _, item := range items {
+		i := strings.Index(item, "=")
+		if i <= 0 || i == len(item)-1 {
+			return nil, fmt.Errorf("expected name=value, got %q", item)
+		}
+		pairs[strings.TrimSpace(item[:i])] = strings.TrimSpace(item[i+1:])
+	}
+	return pairs, nil
+}
+
+// parseTypes parses a comma separated list of column=type pairs.
+func parseTypes(s string) (dfstore.TypeMapping, error) {
+	pairs, err := splitPairs(s)
+	if err != nil {
+		return nil, usageError("-types: " + err.Error())
+	}
+	var types dfstore.TypeMapping
+	for col, t := range pairs {
+		switch ct := dfstore.ColumnType(t); ct {
+		case dfstore.TypeString, dfstore.TypeInt, dfstore.TypeFloat, dfstore.TypeBool:
+			if types == nil {
+				types = make(dfstore.TypeMapping)
+			}
+			types[col] = ct
+		default:
+			return nil, usageError(fmt.Sprintf("-types: unknown type %q, expected string, int, float or bool", t))
+		}
+	}
+	return types, nil
+}
+
+// checkWhere rejects a -where condition on the stores which do not read the
+// query string syntax, all but mongodb.
+func checkWhere(dfs *dfstore.DFStore, where string) error {
+	if where != "" && dfs.Kind != "mongodb" {
+		return usageError(fmt.Sprintf("-where is supported on mongodb only, not %s; use export -filter", dfs.Kind))
+	}
+	return nil
+}
+
+// filterPattern matches a filter such as year >= 2018.
+var filterPattern = regexp.MustCompile(`^\s*([^\s=!<>]+)\s*(==|!=|>=|<=|>|<|=)\s*(.*?)\s*$`)
+
+// filterFlags collects the -filter flags.
+type filterFlags []dataframe.F
+
+func (f *filterFlags) String() string { return "" }
+
+func (f *filterFlags) Set(s string) error {
+	filt, err := parseFilter(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, filt)
+	return nil
+}
+
+// parseFilter parses a filter made of a column, a comparator and a value,
+// which may be quoted.
+func parseFilter(s string) (dataframe.F, error) {
+	m := filterPattern.FindStringSubmatch(s)
+	if m == nil || m[3] == "" {
+		return dataframe.F{}, fmt.Errorf("expected column, comparator and value, got %q", s)
+	}
+	comparator := m[2]
+	if comparator == "=" {
+		comparator = "=="
+	}
+	value := m[3]
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		value = value[1 : len(value)-1]
+	}
+	return dataframe.F{Colname: m[1], Comparator: series.Comparator(comparator), Comparando: value}, nil
+}
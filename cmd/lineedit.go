@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// lineEditor reads lines from a terminal with editing, history and completion,
+// or reads plain lines when the input is not a terminal.
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+	fd  int
+	// history holds the lines entered, the most recent last
+	history []string
+	// complete returns the start of the word ending at pos in line and the
+	// words that may replace it
+	complete func(line string, pos int) (start int, candidates []string)
+}
+
+// maxHistory is the number of lines kept in the history.
+const maxHistory = 500
+
+func newLineEditor(in *os.File, out io.Writer) *lineEditor {
+	return &lineEditor{in: bufio.NewReader(in), out: out, fd: int(in.Fd())}
+}
+
+// addHistory adds a line to the history, skipping empty and repeated lines.
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// readLine prints the prompt and returns the line entered, without its end of
+// line. It returns io.EOF at the end of the input or for Ctrl-D on an empty line.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	defer restore()
+	return e.edit(prompt)
+}
+
+// key codes of the terminal
+const (
+	keyCtrlA     = 1
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlK     = 11
+	keyCtrlU     = 21
+	keyTab       = 9
+	keyEnter     = 13
+	keyNewline   = 10
+	keyEscape    = 27
+	keyBackspace = 127
+	keyCtrlH     = 8
+)
+
+// edit reads keys until the line is entered, redrawing it after each key.
+func (e *lineEditor) edit(prompt string) (string, error) {
+	var buf []rune
+	pos := 0
+	// hist is the position in the history, len(e.history) for the new line
+	hist := len(e.history)
+	saved := ""
+	lastTab := false
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r\x1b[K%s%s", prompt, string(buf))
+		if back := len(buf) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	setLine := func(s string) {
+		buf = []rune(s)
+		pos = len(buf)
+	}
+	redraw()
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			fmt.Fprint(e.out, "\r\n")
+			return "", err
+		}
+		tab := false
+		switch r {
+		case keyEnter, keyNewline:
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case keyCtrlC:
+			// abandon the line
+			fmt.Fprint(e.out, "^C\r\n")
+			buf, pos, hist = nil, 0, len(e.history)
+		case keyCtrlD:
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case keyBackspace, keyCtrlH:
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case keyCtrlA:
+			pos = 0
+		case keyCtrlE:
+			pos = len(buf)
+		case keyCtrlK:
+			buf = buf[:pos]
+		case keyCtrlU:
+			buf = buf[pos:]
+			pos = 0
+		case keyTab:
+			tab = true
+			e.completeLine(&buf, &pos, lastTab, prompt)
+		case keyEscape:
+			switch e.escape() {
+			case 'A': // up
+				if hist > 0 {
+					if hist == len(e.history) {
+						saved = string(buf)
+					}
+					hist--
+					setLine(e.history[hist])
+				}
+			case 'B': // down
+				if hist < len(e.history) {
+					hist++
+					if hist == len(e.history) {
+						setLine(saved)
+					} else {
+						setLine(e.history[hist])
+					}
+				}
+			case 'C': // right
+				if pos < len(buf) {
+					pos++
+				}
+			case 'D': // left
+				if pos > 0 {
+					pos--
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(buf)
+			case '3': // delete
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if r >= ' ' {
+				buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+				pos++
+			}
+		}
+		lastTab = tab
+		redraw()
+	}
+}
+
+// escape reads the rest of an escape sequence and returns its final letter, or
+// the digit of the sequences ending with ~.
+func (e *lineEditor) escape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != '[' && r != 'O' {
+		return 0
+	}
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0
+	}
+	if r >= '0' && r <= '9' {
+		for {
+			next, _, err := e.in.ReadRune()
+			if err != nil || next == '~' {
+				break
+			}
+		}
+	}
+	return r
+}
+
+// completeLine completes the word before the cursor, inserting the common prefix
+// of the candidates. A second tab lists the candidates.
+func (e *lineEditor) completeLine(buf *[]rune, pos *int, list bool, prompt string) {
+	if e.complete == nil {
+		return
+	}
+	line := string(*buf)
+	cursor := len(string((*buf)[:*pos]))
+	start, candidates := e.complete(line, cursor)
+	if len(candidates) == 0 {
+		fmt.Fprint(e.out, "\a")
+		return
+	}
+	prefix := commonPrefix(candidates)
+	if len(prefix) > cursor-start {
+		word := []rune(prefix)
+		before := []rune(line[:start])
+		after := (*buf)[*pos:]
+		*buf = append(append(before, word...), after...)
+		*pos = len(before) + len(word)
+		return
+	}
+	if list && len(candidates) > 1 {
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
+
+// commonPrefix returns the longest prefix of all the words.
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -1,7 +1,183 @@
+// Command dfstore reads and writes the tables of a dfstore backend.
+//
+//	dfstore write [flags] file
+//	dfstore read [flags]
+//	dfstore export [flags]
+//	dfstore schema [flags] [table]
+//	dfstore tables [flags]
+//	dfstore drop [flags] table
+//	dfstore shell [flags]
+//	dfstore copy -from profile -to profile [flags]
+//
+// The backend is a connection profile, "default" unless set by -profile, or a
+// URL given by -url. The table of the profile or URL is used unless set by -table.
+// The copy command reads from the store of -from and writes to the store of -to,
+// each a profile or a URL.
 package main
 
-import ("fmt")
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"dfstore"
+)
+
+// command is a subcommand of the tool.
+type command struct {
+	usage   string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"write":  {"write [flags] file", "load a CSV or JSON file, - for stdin, into a table", runWrite},
+	"read":   {"read [flags]", "read the rows of a table", runRead},
+	"export": {"export [flags]", "write the rows of a table in CSV or NDJSON", runExport},
+	"schema": {"schema [flags] [table]", "show the columns and indexes of a table", runSchema},
+	"tables": {"tables [flags]", "list the tables", runTables},
+	"drop":   {"drop [flags] table", "drop a table", runDrop},
+	"shell":  {"shell [flags]", "run query strings interactively (mongodb)", runShell},
+	"copy":   {"copy -from profile -to profile [flags]", "copy a table to another backend", runCopy},
+}
+
+// usageError is a command line error, reported with the usage of the command.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// errReported is returned for the errors the flag sets already reported.
+var errReported = errors.New("reported")
+
+// stdout is the output of the commands.
+var stdout io.Writer = os.Stdout
+
 func main() {
-	fmt.Println("This package is to test some parsing. It is not finished yet.")
-	fmt.Println("I also use this for CICD test.")
-}
\ No newline at end of file
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the command line and returns the exit status.
+func run(args []string) int {
+	if len(args) < 1 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		usage(os.Stderr)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "dfstore: unknown command %q\n", args[0])
+		usage(os.Stderr)
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := cmd.run(ctx, args[1:])
+	var uerr usageError
+	switch {
+	case err == nil:
+		return 0
+	case err == errReported:
+		return 2
+	case errors.As(err, &uerr):
+		fmt.Fprintf(os.Stderr, "dfstore %s: %v\nusage: dfstore %s\n", args[0], err, cmd.usage)
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "dfstore %s: %v\n", args[0], err)
+		return 1
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: dfstore <command> [flags] [arguments]")
+	fmt.Fprintln(w, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-8s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w, "\nrun dfstore <command> -h for the flags of a command")
+}
+
+// storeFlags are the flags selecting the store, shared by the commands.
+type storeFlags struct {
+	profile string
+	url     string
+	table   string
+	format  string
+	timeout time.Duration
+	verbose bool
+}
+
+// newFlagSet returns the flag set of a command, with the store flags.
+func newFlagSet(name string, sf *storeFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: dfstore %s [flags]\n\nflags:\n", name)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&sf.profile, "profile", "default", "connection profile")
+	fs.StringVar(&sf.url, "url", "", "connection URL, instead of a profile")
+	fs.StringVar(&sf.table, "table", "", "table, instead of the table of the profile or URL")
+	fs.StringVar(&sf.format, "format", "table", "output format: table, csv or json")
+	fs.DurationVar(&sf.timeout, "timeout", 0, "time limit of the command, none when 0")
+	fs.BoolVar(&sf.verbose, "v", false, "log the operations to stderr")
+	return fs
+}
+
+// parse parses the flags of a command.
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errReported
+	}
+	return nil
+}
+
+// open connects to the store selected by the flags.
+func (sf storeFlags) open(ctx context.Context) (*dfstore.DFStore, error) {
+	if _, err := formatter(sf.format); err != nil {
+		return nil, err
+	}
+	var opts []dfstore.Option
+	if sf.verbose {
+		opts = append(opts, dfstore.WithLogger(dfstore.NewTextLogger(os.Stderr, dfstore.LevelDebug)))
+	}
+	var dfs *dfstore.DFStore
+	var err error
+	if sf.url != "" {
+		dfs, err = dfstore.New(ctx, sf.url, opts...)
+	} else {
+		dfs, err = dfstore.NewFromProfile(ctx, sf.profile, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sf.table != "" {
+		dfs.TableName = sf.table
+	}
+	return dfs, nil
+}
+
+// withTimeout applies the -timeout flag to ctx.
+func (sf storeFlags) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if sf.timeout > 0 {
+		return context.WithTimeout(ctx, sf.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// print writes records in the format of the -format flag.
+func (sf storeFlags) print(records [][]string) error {
+	format, err := formatter(sf.format)
+	if err != nil {
+		return err
+	}
+	return format(stdout, records)
+}
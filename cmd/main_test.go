@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"dfstore"
+)
+
+var records = [][]string{
+	{"title", "artist"},
+	{"Blue Train", "John Coltrane"},
+	{"Jeru", `Gerry "Jeru" Mulligan`},
+}
+
+func TestFormats(t *testing.T) {
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{"table", "title       artist\n-----       ------\nBlue Train  John Coltrane\nJeru        Gerry \"Jeru\" Mulligan\n(2 rows)\n"},
+		{"csv", "title,artist\nBlue Train,John Coltrane\nJeru,\"Gerry \"\"Jeru\"\" Mulligan\"\n"},
+		{"json", "[\n  {\"title\":\"Blue Train\",\"artist\":\"John Coltrane\"},\n  {\"title\":\"Jeru\",\"artist\":\"Gerry \\\"Jeru\\\" Mulligan\"}\n]\n"},
+	} {
+		format, err := formatter(tc.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := format(&buf, records); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.format, buf.String(), tc.want)
+		}
+	}
+	var buf bytes.Buffer
+	writeJSON(&buf, records[:1])
+	if buf.String() != "[]\n" {
+		t.Errorf("expected an empty array, got %s", buf.String())
+	}
+	if _, err := formatter("xml"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"unknown"},
+		{"drop"},
+		{"read", "-as", "A", "-columns", "a,b"},
+		{"read", "-format", "xml"},
+		{"write", "-mode", "merge", "books.csv"},
+		{"read", "-bogus"},
+	} {
+		if status := run(args); status != 2 {
+			t.Errorf("%v: expected status 2, got %d", args, status)
+		}
+	}
+	// unknown profiles fail to connect
+	if status := run([]string{"tables", "-profile", "missing"}); status != 1 {
+		t.Errorf("expected status 1, got %d", status)
+	}
+}
+
+func TestSchemaRecords(t *testing.T) {
+	schema := dfstore.TableSchema{
+		Columns: []string{"title", "artist", "year"},
+		Indexes: []dfstore.IndexSpec{
+			{Name: "books_pkey", Columns: []string{"title"}, Unique: true},
+			{Name: "books_artist_year_idx", Columns: []string{"artist", "year"}},
+		},
+	}
+	got := schemaRecords(schema)
+	want := [][]string{
+		{"column", "indexes"},
+		{"title", "books_pkey (unique)"},
+		{"artist", "books_artist_year_idx"},
+		{"year", "books_artist_year_idx"},
+	}
+	if strings.Join(flatten(got), "|") != strings.Join(flatten(want), "|") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		in                     string
+		col, comparator, value string
+	}{
+		{"year >= 2018", "year", ">=", "2018"},
+		{"year=2018", "year", "==", "2018"},
+		{`artist != "The Beatles"`, "artist", "!=", "The Beatles"},
+		{"artist == 'Queen'", "artist", "==", "Queen"},
+	}
+	for _, tt := range tests {
+		f, err := parseFilter(tt.in)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if f.Colname != tt.col || string(f.Comparator) != tt.comparator || f.Comparando != tt.value {
+			t.Errorf("%q: got %v %v %v", tt.in, f.Colname, f.Comparator, f.Comparando)
+		}
+	}
+	for _, in := range []string{"year", "year >=", ">= 2018"} {
+		if _, err := parseFilter(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestCSVFlags(t *testing.T) {
+	cf := csvFlags{delimiter: ";", header: false, columns: "title, year", null: "NULL"}
+	opts, err := cf.options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Comma != ';' || !opts.NoHeader || strings.Join(opts.Columns, ",") != "title,year" || opts.Null != "NULL" {
+		t.Errorf("unexpected options %+v", opts)
+	}
+	cf.delimiter = ";;"
+	if _, err := cf.options(); err == nil {
+		t.Error("expected an error for a delimiter of two characters")
+	}
+}
+
+func TestCheckWhere(t *testing.T) {
+	postgres := &dfstore.DFStore{Kind: "postgres"}
+	err := checkWhere(postgres, `[[year]] != {"2018"}`)
+	if _, ok := err.(usageError); !ok || !strings.Contains(err.Error(), "mongodb only") {
+		t.Errorf("expected a usage error for postgres, got %v", err)
+	}
+	if err := checkWhere(postgres, ""); err != nil {
+		t.Errorf("expected reads without -where on postgres, got %v", err)
+	}
+	if err := checkWhere(&dfstore.DFStore{Kind: "mongodb"}, `[[year]] != {"2018"}`); err != nil {
+		t.Errorf("expected -where on mongodb, got %v", err)
+	}
+}
+
+func flatten(records [][]string) []string {
+	var cells []string
+	for _, row := range records {
+		cells = append(cells, strings.Join(row, ","))
+	}
+	return cells
+}
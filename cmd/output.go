@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// formatter returns the function writing records, whose first row holds the
+// column names, in the named format.
+func formatter(name string) (func(io.Writer, [][]string) error, error) {
+	switch name {
+	case "table":
+		return writeTable, nil
+	case "csv":
+		return writeCSV, nil
+	case "json":
+		return writeJSON, nil
+	default:
+		return nil, usageError(fmt.Sprintf("unknown format %q, expected table, csv or json", name))
+	}
+}
+
+// writeTable writes the records in aligned columns, under a line of dashes.
+func writeTable(w io.Writer, records [][]string) error {
+	if len(records) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	writeRow := func(row []string) {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			// tabs and newlines would break the alignment
+			cells[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(cell)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	writeRow(records[0])
+	dashes := make([]string, len(records[0]))
+	for i, col := range records[0] {
+		dashes[i] = strings.Repeat("-", len(col))
+	}
+	writeRow(dashes)
+	for _, row := range records[1:] {
+		writeRow(row)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "(%d rows)\n", len(records)-1)
+	return err
+}
+
+func writeCSV(w io.Writer, records [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// writeJSON writes the rows as an array of objects keyed by column name, one
+// object per line, with the keys in the order of the columns.
+func writeJSON(w io.Writer, records [][]string) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[")
+	if len(records) > 0 {
+		for i, row := range records[1:] {
+			if i > 0 {
+				bw.WriteString(",")
+			}
+			bw.WriteString("\n  {")
+			for j, val := range row {
+				if j > 0 {
+					bw.WriteString(",")
+				}
+				col := ""
+				if j < len(records[0]) {
+					col = records[0][j]
+				}
+				k, _ := json.Marshal(col)
+				v, _ := json.Marshal(val)
+				bw.Write(k)
+				bw.WriteString(":")
+				bw.Write(v)
+			}
+			bw.WriteString("}")
+		}
+		if len(records) > 1 {
+			bw.WriteString("\n")
+		}
+	}
+	bw.WriteString("]\n")
+	return bw.Flush()
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dfstore"
+)
+
+// metaCommand is a command of the shell, starting with a backslash.
+type metaCommand struct {
+	name string
+	args string
+	help string
+}
+
+var metaCommands = []metaCommand{
+	{`\tables`, "", "list the tables"},
+	{`\schema`, "[table]", "show the columns and indexes of a table"},
+	{`\use`, "table", "read from another table"},
+	{`\columns`, "[a,b,...]", "set the columns read, all the columns when empty"},
+	{`\limit`, "n", "set the maximum number of rows read"},
+	{`\format`, "table|csv|json", "set the output format"},
+	{`\explain`, "query", "show the backend query of a query string"},
+	{`\help`, "", "show this help"},
+	{`\quit`, "", "leave the shell, also \\q or Ctrl-D"},
+}
+
+// historyFile is the file keeping the shell history, in the home directory.
+const historyFile = ".dfstore_history"
+
+// completionTimeout limits the schema lookups made for tab completion.
+const completionTimeout = 2 * time.Second
+
+// checkShell refuses the stores which do not read the query strings of the
+// shell, all but mongodb.
+func checkShell(dfs *dfstore.DFStore) error {
+	if dfs.Kind != "mongodb" {
+		return fmt.Errorf("the shell reads query strings, supported on mongodb only, not %s; use read and export", dfs.Kind)
+	}
+	return nil
+}
+
+// shell runs the lines entered in the dfstore shell.
+type shell struct {
+	dfs    *dfstore.DFStore
+	out    io.Writer
+	format string
+	limit  int
+	// columns are the columns read, all the columns of the table when empty
+	columns []string
+	// tables and schemas cache the names completed
+	tables  []string
+	schemas map[string][]string
+}
+
+func runShell(ctx context.Context, args []string) error {
+	var sf storeFlags
+	fs := newFlagSet("shell", &sf)
+	limit := fs.Int("limit", 20, "maximum number of rows read by a query")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError("unexpected arguments")
+	}
+	dfs, err := sf.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer dfs.Close()
+	if err := checkShell(dfs); err != nil {
+		return err
+	}
+
+	sh := &shell{dfs: dfs, out: stdout, format: sf.format, limit: *limit, schemas: make(map[string][]string)}
+	ed := newLineEditor(os.Stdin, stdout)
+	ed.complete = sh.complete
+	history := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		history = filepath.Join(home, historyFile)
+		ed.history = loadHistory(history)
+	}
+	fmt.Fprintf(stdout, "connected to %s, table %s; enter query strings or \\help\n", dfs.Kind, dfs.TableName)
+	for {
+		line, err := ed.readLine(dfs.TableName + "> ")
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		ed.addHistory(line)
+		if history != "" {
+			appendHistory(history, line)
+		}
+		// Ctrl-C cancels the line running, not the shell
+		lineCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		quit, err := sh.run(lineCtx, line)
+		stop()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// run runs a line of the shell and reports whether the shell is left.
+func (sh *shell) run(ctx context.Context, line string) (quit bool, err error) {
+	if !strings.HasPrefix(line, `\`) {
+		return false, sh.query(ctx, line)
+	}
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	switch name {
+	case `\q`, `\quit`:
+		return true, nil
+	case `\help`, `\h`, `\?`:
+		for _, mc := range metaCommands {
+			fmt.Fprintf(sh.out, "  %-26s %s\n", mc.name+" "+mc.args, mc.help)
+		}
+		fmt.Fprintln(sh.out, "  other lines are query strings, such as [[year]] != {\"2018\"}")
+	case `\tables`:
+		tables, err := sh.dfs.ListTables(ctx)
+		if err != nil {
+			return false, err
+		}
+		sh.tables = tables
+		records := [][]string{{"table"}}
+		for _, table := range tables {
+			records = append(records, []string{table})
+		}
+		return false, sh.print(records)
+	case `\schema`:
+		schema, err := sh.dfs.DescribeTable(ctx, arg)
+		if err != nil {
+			return false, err
+		}
+		sh.schemas[schema.Name] = schema.Columns
+		return false, sh.print(schemaRecords(schema))
+	case `\use`:
+		if arg == "" {
+			return false, fmt.Errorf(`\use needs a table`)
+		}
+		sh.dfs.TableName = arg
+		sh.columns = nil
+	case `\columns`:
+		sh.columns = splitList(arg)
+	case `\limit`:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return false, fmt.Errorf(`\limit needs a positive number`)
+		}
+		sh.limit = n
+	case `\format`:
+		if _, err := formatter(arg); err != nil {
+			return false, err
+		}
+		sh.format = arg
+	case `\explain`:
+		explained, err := sh.dfs.Explain(arg)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintln(sh.out, explained)
+	default:
+		return false, fmt.Errorf(`unknown command %s, see \help`, name)
+	}
+	return false, nil
+}
+
+// query reads the rows matching a query string.
+func (sh *shell) query(ctx context.Context, conditions string) error {
+	columns := sh.columns
+	if len(columns) == 0 {
+		var err error
+		if columns, err = sh.tableColumns(ctx, sh.dfs.TableName); err != nil {
+			return err
+		}
+	}
+	start := time.Now()
+	res, err := sh.dfs.ReadRecordsString(ctx, columns, columns, conditions, sh.limit)
+	if err != nil {
+		return err
+	}
+	if err := sh.print(res); err != nil {
+		return err
+	}
+	if sh.format == "table" {
+		fmt.Fprintf(sh.out, "time: %v\n", time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+func (sh *shell) print(records [][]string) error {
+	format, err := formatter(sh.format)
+	if err != nil {
+		return err
+	}
+	return format(sh.out, records)
+}
+
+// tableColumns returns the columns of a table, looking them up once.
+func (sh *shell) tableColumns(ctx context.Context, table string) ([]string, error) {
+	if columns, ok := sh.schemas[table]; ok {
+		return columns, nil
+	}
+	schema, err := sh.dfs.DescribeTable(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	sh.schemas[table] = schema.Columns
+	return schema.Columns, nil
+}
+
+// complete returns the start of the word ending at pos and the words completing
+// it: meta commands, table names after \use and \schema, and column names after
+// \columns and in the [[column]] references of query strings.
+func (sh *shell) complete(line string, pos int) (int, []string) {
+	before := line[:pos]
+	start := strings.LastIndexAny(before, " \t,[{(") + 1
+	prefix := before[start:]
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	command := ""
+	if fields := strings.Fields(before); len(fields) > 0 {
+		command = fields[0]
+	}
+	var words []string
+	switch {
+	case strings.HasPrefix(line, `\`) && start == 0:
+		for _, mc := range metaCommands {
+			words = append(words, mc.name)
+		}
+	case strings.HasSuffix(before[:start], "[["):
+		columns, _ := sh.tableColumns(ctx, sh.dfs.TableName)
+		for _, col := range columns {
+			words = append(words, col+"]]")
+		}
+	case command == `\use` || command == `\schema`:
+		if sh.tables == nil {
+			sh.tables, _ = sh.dfs.ListTables(ctx)
+		}
+		words = sh.tables
+	case command == `\columns`:
+		words, _ = sh.tableColumns(ctx, sh.dfs.TableName)
+	case command == `\format`:
+		words = []string{"table", "csv", "json"}
+	}
+	var candidates []string
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			candidates = append(candidates, w)
+		}
+	}
+	sort.Strings(candidates)
+	return start, candidates
+}
+
+// loadHistory reads the last lines of the history file.
+func loadHistory(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+	}
+	return lines
+}
+
+// appendHistory adds a line to the history file, ignoring errors.
+func appendHistory(path, line string) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"dfstore"
+)
+
+func testShell(out io.Writer) *shell {
+	dfs := &dfstore.DFStore{Kind: "mongodb", TableName: "books"}
+	return &shell{dfs: dfs, out: out, format: "table", limit: 20,
+		tables:  []string{"books", "bookmarks", "records"},
+		schemas: map[string][]string{"books": {"title", "artist", "year"}}}
+}
+
+func TestCheckShell(t *testing.T) {
+	for _, kind := range []string{"postgres", "redis"} {
+		err := checkShell(&dfstore.DFStore{Kind: kind})
+		if err == nil || !strings.Contains(err.Error(), "mongodb only") {
+			t.Errorf("%s: expected the shell to be refused, got %v", kind, err)
+		}
+	}
+	if err := checkShell(testShell(io.Discard).dfs); err != nil {
+		t.Errorf("expected the shell on mongodb, got %v", err)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	sh := testShell(io.Discard)
+	for _, tc := range []struct {
+		line  string
+		start int
+		want  []string
+	}{
+		{`\s`, 0, []string{`\schema`}},
+		{`\use boo`, 5, []string{"bookmarks", "books"}},
+		{`\schema r`, 8, []string{"records"}},
+		{`\columns title,a`, 15, []string{"artist"}},
+		{`[[ye`, 2, []string{"year]]"}},
+		{`([[artist]] == {"x"}) AND ([[t`, 29, []string{"title]]"}},
+		{`\format j`, 8, []string{"json"}},
+		{`[[year]] != {"20`, 13, nil},
+	} {
+		start, got := sh.complete(tc.line, len(tc.line))
+		if start != tc.start || fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: got %d %v, want %d %v", tc.line, start, got, tc.start, tc.want)
+		}
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	sh := testShell(io.Discard)
+	for _, tc := range []struct {
+		keys string
+		want string
+	}{
+		{"abc\r", "abc"},
+		// backspace, left arrow and insertion
+		{"abd\x7fc\x1b[D\x1b[Dx\r", "axbc"},
+		// home, delete key and end
+		{"xabc\x01\x1b[3~\x05d\r", "abcd"},
+		// Ctrl-C abandons the line
+		{"abc\x03def\r", "def"},
+		// up arrow recalls the previous line, down returns to the new line
+		{"\x1b[A\r", "second"},
+		{"\x1b[A\x1b[A\r", "first"},
+		{"new\x1b[A\x1b[B\r", "new"},
+		// tab completes the column
+		{"[[ar\t == {\"x\"}\r", `[[artist]] == {"x"}`},
+		{"\\us\t books\r", `\use books`},
+	} {
+		var out bytes.Buffer
+		e := &lineEditor{in: bufio.NewReader(strings.NewReader(tc.keys)), out: &out, complete: sh.complete,
+			history: []string{"first", "second"}}
+		got, err := e.edit("> ")
+		if err != nil || got != tc.want {
+			t.Errorf("%q: got %q, %v, want %q", tc.keys, got, err, tc.want)
+		}
+	}
+	e := &lineEditor{in: bufio.NewReader(strings.NewReader("\x04")), out: io.Discard}
+	if _, err := e.edit("> "); err != io.EOF {
+		t.Errorf("expected EOF for Ctrl-D, got %v", err)
+	}
+}
+
+func TestShellCommands(t *testing.T) {
+	var out bytes.Buffer
+	sh := testShell(&out)
+	for _, line := range []string{`\limit 5`, `\format json`, `\columns title, year`, `\use records`} {
+		if quit, err := sh.run(context.TODO(), line); quit || err != nil {
+			t.Fatalf("%s: %v, %v", line, quit, err)
+		}
+	}
+	if sh.limit != 5 || sh.format != "json" || sh.columns != nil || sh.dfs.TableName != "records" {
+		t.Errorf("unexpected shell state %+v", sh)
+	}
+	for _, line := range []string{`\limit x`, `\format xml`, `\use`, `\unknown`} {
+		if _, err := sh.run(context.TODO(), line); err == nil {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+	if _, err := sh.run(context.TODO(), `\explain [[year]] == {"2018"}`); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "db.records.find({\"year\":\"2018\"})\n" {
+		t.Errorf("unexpected explain output %q", got)
+	}
+	if quit, _ := sh.run(context.TODO(), `\q`); !quit {
+		t.Errorf("expected quit")
+	}
+}
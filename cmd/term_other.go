@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// makeRaw is not supported, the shell reads whole lines without editing.
+func makeRaw(fd int) (restore func(), err error) {
+	return nil, errors.New("raw terminal mode not supported")
+}
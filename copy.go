@@ -0,0 +1,412 @@
+package dfstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gota/gota/dataframe"
+	"github.com/go-redis/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CopyOptions controls a call to Copy.
+type CopyOptions struct {
+	// Columns are the source columns copied, all the columns of the table when empty.
+	Columns []string
+	// Filters select the rows copied, the filters without comparator are ignored.
+	Filters []dataframe.F
+	// Rename maps source column names to destination column names.
+	Rename map[string]string
+	// Types are the types of the destination columns, by destination name,
+	// added to the types of the source store.
+	Types TypeMapping
+	// Mode is the write mode of the destination. WriteReplaceTable and
+	// WriteErrorIfExists apply to the first batch, the following ones are
+	// appended. Copies that may be resumed should use WriteUpsert, so that the
+	// batch written again after an interruption replaces its rows.
+	Mode WriteMode
+	// Keys are the destination key columns of WriteUpsert, the first column by default.
+	Keys []string
+	// BatchSize is the number of rows read and written at a time, DefaultBatchSize when 0.
+	BatchSize int
+	// DestTable is the destination table, the table given to Copy by default.
+	DestTable string
+	// Checkpoint names a file keeping the position of the copy after each batch.
+	// A copy started with an existing checkpoint resumes after that position,
+	// the file is removed when the copy completes.
+	Checkpoint string
+	// Progress is called after each batch.
+	Progress func(CopyProgress)
+}
+
+// CopyProgress is the state of a copy after a batch.
+type CopyProgress struct {
+	// Rows is the number of rows copied by this call to Copy.
+	Rows int
+	// Cursor is the position of the copy in the source table: the last primary
+	// key for postgres, the last _id for mongodb and the last row number for redis.
+	Cursor string
+}
+
+// Copy copies the rows of a table of src to dst, reading and writing them in
+// batches in the key order of the source, and returns the number of rows copied.
+// The table of each store is used when table is empty. Each batch is written
+// in its own transaction, the batches written stay in place when Copy fails.
+func Copy(ctx context.Context, src, dst *DFStore, table string, opts CopyOptions) (n int, err error) {
+	s := src.withTable(table)
+	s.Ctx = ctx
+	d := dst.withTable(table)
+	if opts.DestTable != "" {
+		d.TableName = opts.DestTable
+	}
+	d.Ctx = ctx
+	start := time.Now()
+	defer func() {
+		args := []interface{}{"kind", s.Kind, "table", s.TableName, "dest_kind", d.Kind, "dest_table", d.TableName,
+			"rows", n, "duration", time.Since(start)}
+		if err != nil {
+			s.log(LevelError, "copy", append(args, "error", err)...)
+			return
+		}
+		s.log(LevelInfo, "copy", args...)
+	}()
+
+	schema, err := s.DescribeTable(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = schema.Columns
+	}
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col
+		if name, ok := opts.Rename[col]; ok {
+			header[i] = name
+		}
+	}
+	// the destination types are the source types renamed, and the types of the options
+	renamed := make(TypeMapping)
+	for i, col := range columns {
+		if t, ok := s.opts.Types[col]; ok {
+			renamed[header[i]] = t
+		}
+	}
+	d.opts.Types = mergeTypes(renamed, d.opts.Types, opts.Types)
+	if s, err = s.withFilterTypes(opts.Filters); err != nil {
+		return 0, err
+	}
+
+	batchSize := WriteOptions{BatchSize: opts.BatchSize}.batchSize()
+	after := ""
+	if opts.Checkpoint != "" {
+		data, err := os.ReadFile(opts.Checkpoint)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		after = strings.TrimSpace(string(data))
+		if after != "" {
+			s.log(LevelInfo, "copy resumed", "table", s.TableName, "cursor", after)
+		}
+	}
+	wopts := WriteOptions{Mode: opts.Mode, Keys: opts.Keys, BatchSize: batchSize}
+	if after != "" {
+		wopts = wopts.next()
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		rows, next, done, err := s.copyPage(columns, schema.Columns[0], opts.Filters, after, batchSize)
+		if err != nil {
+			return n, err
+		}
+		if len(rows) > 0 {
+			if err := d.WriteRecordsWithOptions(ctx, append([][]string{header}, rows...), wopts); err != nil {
+				return n, err
+			}
+			wopts = wopts.next()
+			n += len(rows)
+		}
+		if next != "" {
+			after = next
+		}
+		if opts.Checkpoint != "" {
+			if err := writeCheckpoint(opts.Checkpoint, after); err != nil {
+				return n, err
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(CopyProgress{Rows: n, Cursor: after})
+		}
+		if done {
+			break
+		}
+	}
+	if opts.Checkpoint != "" {
+		if err := os.Remove(opts.Checkpoint); err != nil && !os.IsNotExist(err) {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// writeCheckpoint replaces the content of the checkpoint file with the cursor.
+func writeCheckpoint(path, cursor string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(cursor+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// copyPage reads the columns of up to n rows following the cursor after, in key
+// order, and returns the rows matching the filters, the cursor of the last row
+// read and whether the table is exhausted. key is the primary key of postgres tables.
+func (dfs DFStore) copyPage(columns []string, key string, filters []dataframe.F, after string, n int) (rows [][]string, next string, done bool, err error) {
+	switch dfs.Kind {
+	case "postgres":
+		return dfs.postgresCopyPage(columns, key, filters, after, n)
+	case "mongodb":
+		return dfs.mongodbCopyPage(columns, filters, after, n)
+	case "redis":
+		return dfs.redisCopyPage(columns, filters, after, n)
+	default:
+		return nil, "", false, fmt.Errorf("not supported: %v", dfs.Kind)
+	}
+}
+
+func (dfs DFStore) postgresCopyPage(columns []string, key string, filters []dataframe.F, after string, n int) ([][]string, string, bool, error) {
+	var conditions []string
+	var args []interface{}
+	if after != "" {
+		args = append(args, after)
+		conditions = append(conditions, fmt.Sprintf("%s > $%d", key, len(args)))
+	}
+	for _, filt := range filters {
+		if filt.Comparator == "" {
+			continue
+		}
+		switch filt.Comparator {
+		case "==", "!=", ">", ">=", "<", "<=":
+		default:
+			return nil, "", false, fmt.Errorf("comparator %s not supported", filt.Comparator)
+		}
+		args = append(args, fmt.Sprintf("%v", filt.Comparando))
+		conditions = append(conditions, fmt.Sprintf("%s %s $%d", filt.Colname, compTranslate(string(filt.Comparator)), len(args)))
+	}
+	qStr := fmt.Sprintf("SELECT %s, %s FROM %s", key, strings.Join(columns, ","), dfs.TableName)
+	if len(conditions) > 0 {
+		qStr += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	qStr += fmt.Sprintf(" ORDER BY %s LIMIT %d", key, n)
+	dfs.debug("postgres copy page", "table", dfs.TableName, "sql", qStr)
+	res, err := dfs.postgresExecer().QueryContext(dfs.Ctx, qStr, args...)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer res.Close()
+	var rows [][]string
+	next := ""
+	vals := make([]sql.NullString, len(columns)+1)
+	dest := make([]interface{}, len(vals))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	for res.Next() {
+		if err := res.Scan(dest...); err != nil {
+			return nil, "", false, err
+		}
+		next = vals[0].String
+		row := make([]string, len(columns))
+		for i := range columns {
+			row[i] = vals[i+1].String
+		}
+		rows = append(rows, row)
+	}
+	if err := res.Err(); err != nil {
+		return nil, "", false, err
+	}
+	return rows, next, len(rows) < n, nil
+}
+
+func (dfs DFStore) mongodbCopyPage(columns []string, filters []dataframe.F, after string, n int) ([][]string, string, bool, error) {
+	docs, next, done, err := dfs.mongodbPage(filters, nil, after, n)
+	if err != nil {
+		return nil, "", false, err
+	}
+	rows := make([][]string, len(docs))
+	for j, doc := range docs {
+		m := doc.Map()
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			if v, ok := m[col]; ok && v != nil {
+				row[i] = mongoValueString(v)
+			}
+		}
+		rows[j] = row
+	}
+	return rows, next, done, nil
+}
+
+// mongodbPage reads up to n documents matching the filters following the _id
+// after, in _id order, with the fields of the projection, all the fields when
+// nil. It returns the _id of the last document and whether the collection is
+// exhausted.
+func (dfs DFStore) mongodbPage(filters []dataframe.F, projection bson.D, after string, n int) ([]bson.D, string, bool, error) {
+	conditions := dfs.mongoConditions(filters)
+	if after != "" {
+		var id interface{} = after
+		if oid, err := primitive.ObjectIDFromHex(after); err == nil {
+			id = oid
+		}
+		conditions = append(conditions, bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: id}}}})
+	}
+	filter := bson.D{}
+	if len(conditions) > 0 {
+		filter = bson.D{{Key: "$and", Value: conditions}}
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(n))
+	if projection != nil {
+		findOptions.SetProjection(projection)
+	}
+	collection := dfs.MongodbClient.Database(dfs.DBName).Collection(dfs.TableName)
+	cur, err := collection.Find(dfs.Ctx, filter, findOptions)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer cur.Close(dfs.Ctx)
+	var docs []bson.D
+	next := ""
+	for cur.Next(dfs.Ctx) {
+		var doc bson.D
+		if err := cur.Decode(&doc); err != nil {
+			return nil, "", false, err
+		}
+		next = mongoValueString(doc.Map()["_id"])
+		docs = append(docs, doc)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, "", false, err
+	}
+	return docs, next, len(docs) < n, nil
+}
+
+func (dfs DFStore) redisCopyPage(columns []string, filters []dataframe.F, after string, n int) ([][]string, string, bool, error) {
+	min := "-inf"
+	if after != "" {
+		min = "(" + after
+	}
+	var ids []string
+	err := contextDo(dfs.Ctx, func() (err error) {
+		ids, err = dfs.RedisClient.ZRangeByScore(redisRowsKey(dfs.TableName),
+			redis.ZRangeBy{Min: min, Max: "+inf", Count: int64(n)}).Result()
+		return err
+	})
+	if err != nil || len(ids) == 0 {
+		return nil, "", true, err
+	}
+	// the filters need the values of their columns
+	names := append([]string(nil), columns...)
+	for _, filt := range filters {
+		if filt.Comparator != "" {
+			names = append(names, filt.Colname)
+		}
+	}
+	pipe := dfs.RedisClient.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HMGet(redisRowKey(dfs.TableName, id), names...)
+	}
+	err = contextDo(dfs.Ctx, func() error {
+		_, err := pipe.Exec()
+		return err
+	})
+	if err != nil {
+		return nil, "", false, err
+	}
+	var rows [][]string
+	for _, cmd := range cmds {
+		vals := cmd.Val()
+		values := make(map[string]string, len(names))
+		found := false
+		for i, v := range vals {
+			if s, ok := v.(string); ok {
+				values[names[i]] = s
+				found = true
+			}
+		}
+		// skip the rows removed after the index was read
+		if !found || !matchFilters(values, filters) {
+			continue
+		}
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			row[i] = values[col]
+		}
+		rows = append(rows, row)
+	}
+	return rows, ids[len(ids)-1], len(ids) < n, nil
+}
+
+// matchFilters reports whether the values of a row match all the filters,
+// comparing numbers as numbers.
+func matchFilters(values map[string]string, filters []dataframe.F) bool {
+	for _, filt := range filters {
+		if filt.Comparator == "" {
+			continue
+		}
+		val := values[filt.Colname]
+		if filt.Comparator == "in" {
+			found := false
+			for _, s := range comparandoStrings(filt.Comparando) {
+				found = found || s == val
+			}
+			if !found {
+				return false
+			}
+			continue
+		}
+		want := fmt.Sprintf("%v", filt.Comparando)
+		cmp := strings.Compare(val, want)
+		a, errA := strconv.ParseFloat(val, 64)
+		b, errB := strconv.ParseFloat(want, 64)
+		if errA == nil && errB == nil {
+			switch {
+			case a < b:
+				cmp = -1
+			case a > b:
+				cmp = 1
+			default:
+				cmp = 0
+			}
+		}
+		var ok bool
+		switch filt.Comparator {
+		case "==":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,245 @@
+package dfstore
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-gota/gota/dataframe"
+)
+
+// CSVOptions is the dialect of the files read by ImportCSV and written by ExportCSV.
+type CSVOptions struct {
+	// Comma is the field delimiter, ',' when 0.
+	Comma rune
+	// Comment starts the lines ignored by ImportCSV, none when 0.
+	Comment rune
+	// LazyQuotes lets ImportCSV read quotes in unquoted fields and unescaped
+	// quotes in quoted fields.
+	LazyQuotes bool
+	// TrimLeadingSpace ignores the spaces before the fields read by ImportCSV.
+	TrimLeadingSpace bool
+	// QuoteAll quotes every field written by ExportCSV, instead of the fields
+	// holding delimiters, quotes or line ends only.
+	QuoteAll bool
+	// UseCRLF ends the lines written by ExportCSV with \r\n.
+	UseCRLF bool
+	// NoHeader means the file has no header row: ImportCSV reads data from the
+	// first row and takes the column names from Columns, ExportCSV writes rows only.
+	NoHeader bool
+	// Columns are the column names of ImportCSV, replacing the names of the header
+	// row when the file has one, and the columns written by ExportCSV, all the
+	// columns of the table by default.
+	Columns []string
+	// Null marks the missing values: ImportCSV writes the fields equal to Null as
+	// empty values, nil in typed columns, and ExportCSV writes Null for empty values.
+	Null string
+	// Types are type hints for the columns imported, added to the types of the store.
+	Types TypeMapping
+	// Write controls the writes of ImportCSV, which writes the rows in batches of
+	// Write.BatchSize. WriteReplaceTable and WriteErrorIfExists apply to the first
+	// batch, the following ones are appended.
+	Write WriteOptions
+	// BatchSize is the number of rows read at a time by ExportCSV, DefaultBatchSize when 0.
+	BatchSize int
+}
+
+// comma returns the field delimiter, applying the default.
+func (opts CSVOptions) comma() rune {
+	if opts.Comma != 0 {
+		return opts.Comma
+	}
+	return ','
+}
+
+// ImportCSV reads a CSV file and writes its rows to a table, the table of the
+// store when table is empty, and returns the number of rows written. The rows are
+// written as they are read, a batch at a time, so the file is not held in memory.
+// The batches written stay in place when ImportCSV fails.
+func (dfs DFStore) ImportCSV(ctx context.Context, r io.Reader, table string, opts CSVOptions) (n int, err error) {
+	dfs = dfs.withTable(table)
+	dfs.Ctx = ctx
+	start := time.Now()
+	defer func() {
+		args := []interface{}{"kind", dfs.Kind, "table", dfs.TableName, "rows", n, "duration", time.Since(start)}
+		if err != nil {
+			dfs.log(LevelError, "import csv", append(args, "error", err)...)
+			return
+		}
+		dfs.log(LevelInfo, "import csv", args...)
+	}()
+	if len(opts.Types) > 0 {
+		dfs.opts.Types = mergeTypes(dfs.opts.Types, opts.Types)
+	}
+
+	cr := csv.NewReader(r)
+	cr.Comma = opts.comma()
+	cr.Comment = opts.Comment
+	cr.LazyQuotes = opts.LazyQuotes
+	cr.TrimLeadingSpace = opts.TrimLeadingSpace
+	header := opts.Columns
+	if opts.NoHeader {
+		if len(header) == 0 {
+			return 0, fmt.Errorf("no columns for a file without header")
+		}
+		cr.FieldsPerRecord = len(header)
+	} else {
+		names, err := cr.Read()
+		if err == io.EOF {
+			return 0, fmt.Errorf("no header")
+		}
+		if err != nil {
+			return 0, err
+		}
+		if len(header) == 0 {
+			header = names
+		} else if len(header) != len(names) {
+			return 0, fmt.Errorf("%d columns for a header of %d columns", len(header), len(names))
+		}
+	}
+
+	wopts := opts.Write
+	batchSize := wopts.batchSize()
+	records := [][]string{header}
+	flush := func() error {
+		if len(records) == 1 {
+			return nil
+		}
+		if err := dfs.WriteRecordsWithOptions(ctx, records, wopts); err != nil {
+			return err
+		}
+		wopts = wopts.next()
+		n += len(records) - 1
+		records = [][]string{header}
+		return nil
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		if opts.Null != "" {
+			for i, val := range row {
+				if val == opts.Null {
+					row[i] = ""
+				}
+			}
+		}
+		records = append(records, row)
+		if len(records)-1 == batchSize {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, flush()
+}
+
+// ExportCSV writes the rows of a table matching the filters to w in CSV, the
+// table of the store when table is empty, and returns the number of rows written.
+// The filters without comparator are ignored. The rows are read a batch at a
+// time in the key order of the table, so the table is not held in memory.
+func (dfs DFStore) ExportCSV(ctx context.Context, w io.Writer, table string, filters []dataframe.F, opts CSVOptions) (n int, err error) {
+	dfs = dfs.withTable(table)
+	dfs.Ctx = ctx
+	start := time.Now()
+	defer func() {
+		args := []interface{}{"kind", dfs.Kind, "table", dfs.TableName, "rows", n, "duration", time.Since(start)}
+		if err != nil {
+			dfs.log(LevelError, "export csv", append(args, "error", err)...)
+			return
+		}
+		dfs.log(LevelInfo, "export csv", args...)
+	}()
+	schema, err := dfs.DescribeTable(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = schema.Columns
+	}
+	if dfs, err = dfs.withFilterTypes(filters); err != nil {
+		return 0, err
+	}
+
+	cw := newCSVWriter(w, opts)
+	if !opts.NoHeader {
+		cw.write(columns)
+	}
+	batchSize := WriteOptions{BatchSize: opts.BatchSize}.batchSize()
+	after := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		rows, next, done, err := dfs.copyPage(columns, schema.Columns[0], filters, after, batchSize)
+		if err != nil {
+			return n, err
+		}
+		for _, row := range rows {
+			if opts.Null != "" {
+				for i, val := range row {
+					if val == "" {
+						row[i] = opts.Null
+					}
+				}
+			}
+			cw.write(row)
+		}
+		n += len(rows)
+		if err := cw.flush(); err != nil {
+			return n, err
+		}
+		if done || next == "" {
+			return n, nil
+		}
+		after = next
+	}
+}
+
+// csvWriter writes CSV rows in the dialect of the options, quoting the fields
+// which need it or all of them.
+type csvWriter struct {
+	w     *bufio.Writer
+	comma string
+	eol   string
+	all   bool
+}
+
+func newCSVWriter(w io.Writer, opts CSVOptions) *csvWriter {
+	cw := &csvWriter{w: bufio.NewWriter(w), comma: string(opts.comma()), eol: "\n", all: opts.QuoteAll}
+	if opts.UseCRLF {
+		cw.eol = "\r\n"
+	}
+	return cw
+}
+
+func (cw *csvWriter) write(row []string) {
+	for i, field := range row {
+		if i > 0 {
+			cw.w.WriteString(cw.comma)
+		}
+		if cw.all || field == "" && len(row) == 1 || strings.ContainsAny(field, cw.comma+"\"\r\n") ||
+			field != "" && (field[0] == ' ' || field[0] == '\t') {
+			cw.w.WriteString(`"` + strings.ReplaceAll(field, `"`, `""`) + `"`)
+			continue
+		}
+		cw.w.WriteString(field)
+	}
+	cw.w.WriteString(cw.eol)
+}
+
+func (cw *csvWriter) flush() error {
+	return cw.w.Flush()
+}
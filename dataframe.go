@@ -0,0 +1,261 @@
+package dfstore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-gota/gota/dataframe"
+	"github.com/go-gota/gota/series"
+	"github.com/go-redis/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// redisTypesKey returns the key of the hash of column name to column type of a
+// redis table, recorded by WriteDataFrame and WriteJSON.
+func redisTypesKey(table string) string {
+	return "types:" + table
+}
+
+// WriteDataFrame writes the rows of a data frame, storing its Int, Float and
+// Bool columns as numbers and booleans so that ReadDataFrame returns the same
+// series types. Missing values are stored as nil, as empty strings in String
+// columns. The types of the series take precedence over the types of the store.
+func (dfs DFStore) WriteDataFrame(ctx context.Context, df dataframe.DataFrame, opts WriteOptions) error {
+	dfs.Ctx = ctx
+	if df.Err != nil {
+		return df.Err
+	}
+	records, types := dataFrameRecords(df)
+	dfs.opts.Types = mergeTypes(dfs.opts.Types, types)
+	if err := dfs.WriteRecordsWithOptions(ctx, records, opts); err != nil {
+		return err
+	}
+	if dfs.Kind != "redis" {
+		return nil
+	}
+	return dfs.redisRecordTypes(types, opts.Mode == WriteReplaceTable)
+}
+
+// redisRecordTypes records the types of columns next to a redis table, which
+// stores strings, replacing the types recorded before when replace is set.
+func (dfs DFStore) redisRecordTypes(types TypeMapping, replace bool) error {
+	fields := make(map[string]interface{}, len(types))
+	for col, t := range types {
+		fields[col] = string(t)
+	}
+	pipe := dfs.RedisClient.TxPipeline()
+	if replace {
+		pipe.Del(redisTypesKey(dfs.TableName))
+	}
+	if len(fields) > 0 {
+		pipe.HMSet(redisTypesKey(dfs.TableName), fields)
+	}
+	return contextDo(dfs.Ctx, func() error {
+		_, err := pipe.Exec()
+		return err
+	})
+}
+
+// ReadDataFrame reads the rows matching the filters, like ReadRecords, into a
+// data frame whose series have the types of the columns: the postgres column
+// types, the types of the values of a mongodb document, or the types recorded
+// by WriteDataFrame for redis. Other columns have the types of the store, or
+// are String series.
+func (dfs DFStore) ReadDataFrame(ctx context.Context, filters []dataframe.F, limit int) (dataframe.DataFrame, error) {
+	dfs.Ctx = ctx
+	columns := make([]string, 0, len(filters))
+	for _, filt := range filters {
+		columns = append(columns, filt.Colname)
+	}
+	stored, err := dfs.columnTypes(columns)
+	if err != nil {
+		return dataframe.DataFrame{}, err
+	}
+	dfs.opts.Types = mergeTypes(dfs.opts.Types, stored)
+	records, err := dfs.ReadRecords(ctx, filters, limit)
+	if err != nil {
+		return dataframe.DataFrame{}, err
+	}
+	return recordsDataFrame(records, dfs.opts.Types), nil
+}
+
+// dataFrameRecords returns the records of a data frame, header first, and the
+// types of its columns. Missing values are empty strings.
+func dataFrameRecords(df dataframe.DataFrame) ([][]string, TypeMapping) {
+	names := df.Names()
+	types := make(TypeMapping, len(names))
+	cols := make([]series.Series, len(names))
+	for j, name := range names {
+		cols[j] = df.Col(name)
+		switch cols[j].Type() {
+		case series.Int:
+			types[name] = TypeInt
+		case series.Float:
+			types[name] = TypeFloat
+		case series.Bool:
+			types[name] = TypeBool
+		default:
+			types[name] = TypeString
+		}
+	}
+	records := make([][]string, 0, df.Nrow()+1)
+	records = append(records, names)
+	for i := 0; i < df.Nrow(); i++ {
+		row := make([]string, len(cols))
+		for j, col := range cols {
+			e := col.Elem(i)
+			switch {
+			case e.IsNA():
+			case col.Type() == series.Float:
+				// %f of gota would round to 6 decimals
+				row[j] = strconv.FormatFloat(e.Float(), 'g', -1, 64)
+			default:
+				row[j] = e.String()
+			}
+		}
+		records = append(records, row)
+	}
+	return records, types
+}
+
+// recordsDataFrame builds a data frame from records, header first, with series
+// of the types of the columns. Empty values are missing values in Int, Float
+// and Bool series.
+func recordsDataFrame(records [][]string, types TypeMapping) dataframe.DataFrame {
+	if len(records) == 0 {
+		return dataframe.New()
+	}
+	header := records[0]
+	cols := make([]series.Series, len(header))
+	for j, name := range header {
+		vals := make([]string, len(records)-1)
+		for i, row := range records[1:] {
+			if j < len(row) {
+				vals[i] = row[j]
+			}
+		}
+		t := series.String
+		switch types[name] {
+		case TypeInt:
+			t = series.Int
+		case TypeFloat:
+			t = series.Float
+		case TypeBool:
+			t = series.Bool
+		}
+		if t != series.String {
+			for i, v := range vals {
+				if v == "" || v == "<nil>" {
+					vals[i] = "NaN"
+				}
+			}
+		}
+		cols[j] = series.New(vals, t, name)
+	}
+	return dataframe.New(cols...)
+}
+
+// withFilterTypes returns a copy of the store whose type mapping holds the
+// types of the mongodb documents for the columns of the filters, so that the
+// filters compare values of the same types. Other stores are returned as is.
+func (dfs DFStore) withFilterTypes(filters []dataframe.F) (DFStore, error) {
+	if dfs.Kind != "mongodb" {
+		return dfs, nil
+	}
+	var columns []string
+	for _, filt := range filters {
+		if filt.Comparator != "" {
+			columns = append(columns, filt.Colname)
+		}
+	}
+	if len(columns) == 0 {
+		return dfs, nil
+	}
+	stored, err := dfs.columnTypes(columns)
+	if err != nil {
+		return dfs, err
+	}
+	dfs.opts.Types = mergeTypes(stored, dfs.opts.Types)
+	return dfs, nil
+}
+
+// columnTypes returns the types the backend keeps for the columns of the table.
+func (dfs DFStore) columnTypes(columns []string) (TypeMapping, error) {
+	types := make(TypeMapping)
+	switch dfs.Kind {
+	case "postgres":
+		if dfs.PostgresClient == nil {
+			return nil, fmt.Errorf("PostgresClient not initialized")
+		}
+		qStr := "SELECT column_name, data_type FROM information_schema.columns WHERE table_name = $1"
+		dfs.debug("postgres column types", "table", dfs.TableName, "sql", qStr)
+		rows, err := dfs.postgresExecer().QueryContext(dfs.Ctx, qStr, strings.ToLower(dfs.TableName))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name, dataType string
+			if err := rows.Scan(&name, &dataType); err != nil {
+				return nil, err
+			}
+			switch dataType {
+			case "bigint", "integer", "smallint":
+				types[name] = TypeInt
+			case "double precision", "real", "numeric":
+				types[name] = TypeFloat
+			case "boolean":
+				types[name] = TypeBool
+			default:
+				types[name] = TypeString
+			}
+		}
+		return types, rows.Err()
+	case "mongodb":
+		if dfs.MongodbClient == nil {
+			return nil, fmt.Errorf("MongodbClient not initialized")
+		}
+		var doc bson.M
+		err := dfs.MongodbClient.Database(dfs.DBName).Collection(dfs.TableName).FindOne(dfs.Ctx, bson.D{}).Decode(&doc)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return types, nil
+			}
+			return nil, err
+		}
+		for _, col := range columns {
+			switch doc[col].(type) {
+			case int32, int64:
+				types[col] = TypeInt
+			case float64:
+				types[col] = TypeFloat
+			case bool:
+				types[col] = TypeBool
+			case string:
+				types[col] = TypeString
+			}
+		}
+		return types, nil
+	case "redis":
+		if dfs.RedisClient == nil {
+			return nil, fmt.Errorf("RedisClient not initialized")
+		}
+		var stored map[string]string
+		err := contextDo(dfs.Ctx, func() (err error) {
+			stored, err = dfs.RedisClient.HGetAll(redisTypesKey(dfs.TableName)).Result()
+			return err
+		})
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for col, t := range stored {
+			types[col] = ColumnType(t)
+		}
+		return types, nil
+	default:
+		return nil, fmt.Errorf("not supported: %v", dfs.Kind)
+	}
+}
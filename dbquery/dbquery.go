@@ -5,8 +5,6 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/bobbae/q"
-
 	"go.mongodb.org/mongo-driver/bson"
 )
 
@@ -336,17 +334,14 @@ func (dq *dbquery) TranslateQuery(str string) (composites, error) {
 
 	err := dq.checkValidSyntax(str)
 	if err != nil {
-		q.Q("ERROR: ", err)
 		return composites{}, err
 	}
 	process_str, err := dq.constructValueElem(str)
 	if err != nil {
-		q.Q("ERROR: ", err)
 		return composites{}, err
 	}
 	process_str, err = dq.constructKeyElem(process_str)
 	if err != nil {
-		q.Q("ERROR: ", err)
 		return composites{}, err
 	}
 	//q.Q("TRACE: ", process_str)
@@ -481,8 +476,7 @@ func (dq *dbquery) constructBson(input composites) (bson.D, error) {
 			}
 			bson_comp = append(bson_comp, bson_composites)
 		default:
-			// do nothing
-			q.Q("WARNING: ", i, "unrecognized interface", elem)
+			return bson.D{}, fmt.Errorf("unrecognized element %d, %v", i, elem)
 		}
 	}
 	// check if the convertVAlue(value[0].m) is the value or the composites
@@ -537,19 +531,26 @@ func (dq *dbquery) constructBson(input composites) (bson.D, error) {
 
 // Translate the query to the group of elements (composites)
 func (dq *dbquery) GetMongoQueryBson(str string) (bson.D, error) {
-	var comp composites
+	comp, err := dq.ParseQuery(str)
+	if err != nil {
+		return bson.D{}, err
+	}
+
+	return dq.CompileMongo(comp)
+}
 
+// Parse the query to the group of elements (composites), to be compiled by CompileMongo
+func (dq *dbquery) ParseQuery(str string) (composites, error) {
 	dq.setMapStrPrefix(str)
 
 	// clear the element databases; use the new map
 	dq.mapElement = make(map[string]interface{}, 60)
 	dq.mapCnt = 0
 
-	comp, err := dq.TranslateQuery(str)
-	if err != nil {
-		q.Q("ERROR: ", "translateQuery", err)
-		return bson.D{}, err
-	}
+	return dq.TranslateQuery(str)
+}
 
+// Compile the elements of the last parsed query to a mongo filter
+func (dq *dbquery) CompileMongo(comp composites) (bson.D, error) {
 	return dq.constructBson(comp)
 }
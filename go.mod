@@ -8,6 +8,7 @@ require (
 	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/lib/pq v1.10.5
 	go.mongodb.org/mongo-driver v1.9.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,142 @@
+package dfstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Stats is the status of the connection of a store to its backend.
+type Stats struct {
+	Kind string
+	// Latency is the round trip time of the last successful Ping.
+	Latency  time.Duration
+	LastPing time.Time
+	// LastError is the error of the last failed Ping or operation, nil when
+	// none failed. It is kept after later successes, see LastErrorTime.
+	LastError     error
+	LastErrorTime time.Time
+	Pool          PoolStats
+}
+
+// PoolStats is the usage of the connection pool of a store.
+type PoolStats struct {
+	// Open is the number of connections open, in use or idle.
+	Open  int
+	InUse int
+	Idle  int
+	// Timeouts is the number of times no connection was available in time.
+	Timeouts int64
+	// SQL and Redis are the statistics of the postgres and redis pools,
+	// the mongodb statistics are counted from the pool events.
+	SQL   *sql.DBStats
+	Redis *redis.PoolStats
+}
+
+// health holds the status of the connection, shared by the copies of a store.
+type health struct {
+	mu            sync.Mutex
+	latency       time.Duration
+	lastPing      time.Time
+	lastError     error
+	lastErrorTime time.Time
+	// mongodb pool counts
+	open, inUse int
+	timeouts    int64
+}
+
+// recordError keeps err as the last error when it is not nil.
+func (h *health) recordError(err error) {
+	if h == nil || err == nil {
+		return
+	}
+	h.mu.Lock()
+	h.lastError, h.lastErrorTime = err, time.Now()
+	h.mu.Unlock()
+}
+
+// poolMonitor counts the connections of a mongodb pool.
+func (h *health) poolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{Event: func(e *event.PoolEvent) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		switch e.Type {
+		case event.ConnectionCreated:
+			h.open++
+		case event.ConnectionClosed:
+			h.open--
+		case event.GetSucceeded:
+			h.inUse++
+		case event.ConnectionReturned:
+			h.inUse--
+		case event.GetFailed:
+			if e.Reason == event.ReasonTimedOut {
+				h.timeouts++
+			}
+		}
+	}}
+}
+
+// Ping checks that the backend is reachable, such as for a readiness probe.
+// Its latency and error are reported by Stats. Ping is not retried.
+func (dfs DFStore) Ping(ctx context.Context) (err error) {
+	start := time.Now()
+	switch dfs.Kind {
+	case "redis":
+		err = contextDo(ctx, func() error { return dfs.RedisClient.Ping().Err() })
+	case "postgres":
+		err = dfs.PostgresClient.PingContext(ctx)
+	case "mongodb":
+		err = dfs.MongodbClient.Ping(ctx, readpref.Primary())
+	default:
+		return fmt.Errorf("not supported: %v", dfs.Kind)
+	}
+	elapsed := time.Since(start)
+	dfs.debug("ping", "kind", dfs.Kind, "duration", elapsed, "error", err)
+	if dfs.health == nil {
+		return err
+	}
+	if err != nil {
+		dfs.health.recordError(err)
+		return err
+	}
+	dfs.health.mu.Lock()
+	dfs.health.latency, dfs.health.lastPing = elapsed, start
+	dfs.health.mu.Unlock()
+	return nil
+}
+
+// Stats returns the status of the connection without contacting the backend.
+func (dfs DFStore) Stats() Stats {
+	stats := Stats{Kind: dfs.Kind}
+	if dfs.health != nil {
+		dfs.health.mu.Lock()
+		stats.Latency, stats.LastPing = dfs.health.latency, dfs.health.lastPing
+		stats.LastError, stats.LastErrorTime = dfs.health.lastError, dfs.health.lastErrorTime
+		if dfs.Kind == "mongodb" {
+			stats.Pool = PoolStats{Open: dfs.health.open, InUse: dfs.health.inUse,
+				Idle: dfs.health.open - dfs.health.inUse, Timeouts: dfs.health.timeouts}
+		}
+		dfs.health.mu.Unlock()
+	}
+	switch dfs.Kind {
+	case "redis":
+		if dfs.RedisClient != nil {
+			rs := dfs.RedisClient.PoolStats()
+			stats.Pool = PoolStats{Open: int(rs.TotalConns), InUse: int(rs.TotalConns - rs.IdleConns),
+				Idle: int(rs.IdleConns), Timeouts: int64(rs.Timeouts), Redis: rs}
+		}
+	case "postgres":
+		if dfs.PostgresClient != nil {
+			ps := dfs.PostgresClient.Stats()
+			stats.Pool = PoolStats{Open: ps.OpenConnections, InUse: ps.InUse, Idle: ps.Idle, SQL: &ps}
+		}
+	}
+	return stats
+}
@@ -0,0 +1,337 @@
+package dfstore
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec describes an index on one or more columns of a table.
+type IndexSpec struct {
+	// Name defaults to <table>_<columns>_idx when empty. Redis indexes are
+	// named after their column.
+	Name    string
+	Columns []string
+	Unique  bool
+	// Sorted makes a redis index a RedisIndexSorted index, which answers range
+	// filters on numbers. Postgres and mongodb indexes answer them already.
+	Sorted bool
+}
+
+// TableSchema declares a table, its columns and the indexes created with it.
+// The first column is the primary key of SQL tables.
+type TableSchema struct {
+	Name    string
+	Columns []string
+	Indexes []IndexSpec
+}
+
+// indexName returns the name of the index, deriving it from the table and the columns when unset.
+func (spec IndexSpec) indexName(table string) string {
+	if spec.Name != "" {
+		return spec.Name
+	}
+	return fmt.Sprintf("%s_%s_idx", table, strings.Join(spec.Columns, "_"))
+}
+
+// withTable returns a copy of the store operating on another table of the same database.
+// The table of the store is kept when table is empty.
+func (dfs DFStore) withTable(table string) DFStore {
+	if table != "" {
+		dfs.TableName = table
+	}
+	return dfs
+}
+
+// CreateTable creates the table described by schema, records its columns and
+// creates its indexes. Existing tables and indexes are left in place.
+func (dfs DFStore) CreateTable(ctx context.Context, schema TableSchema) error {
+	dfs.Ctx = ctx
+	if len(schema.Columns) < 1 {
+		return fmt.Errorf("not enough columns")
+	}
+	t := dfs.withTable(schema.Name)
+	switch dfs.Kind {
+	case "postgres":
+		if dfs.PostgresClient == nil {
+			return fmt.Errorf("PostgresClient not initialized")
+		}
+		if err := t.PostgresCreateTable(ctx, t.TableName, t.postgresColumnDefs(schema.Columns)); err != nil {
+			return err
+		}
+		if err := t.postgresRegisterSchema(schema.Columns); err != nil {
+			return err
+		}
+	case "mongodb":
+		if dfs.MongodbClient == nil {
+			return fmt.Errorf("MongodbClient not initialized")
+		}
+		names, err := dfs.MongodbClient.Database(dfs.DBName).ListCollectionNames(dfs.Ctx, bson.D{{Key: "name", Value: t.TableName}})
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			if err := dfs.MongodbClient.Database(dfs.DBName).CreateCollection(dfs.Ctx, t.TableName); err != nil {
+				return err
+			}
+		}
+	case "redis":
+		if dfs.RedisClient == nil {
+			return fmt.Errorf("RedisClient not initialized")
+		}
+		if err := dfs.RedisClient.Set("schema:"+t.TableName, strings.Join(schema.Columns, ","), 0).Err(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("not supported: %v", dfs.Kind)
+	}
+	for _, spec := range schema.Indexes {
+		if err := t.createIndex(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateIndex creates an index on the columns of a table. The table of the store is
+// used when table is empty. Redis supports only non unique indexes on a single column.
+func (dfs DFStore) CreateIndex(ctx context.Context, table string, columns []string, unique bool) error {
+	dfs.Ctx = ctx
+	return dfs.withTable(table).createIndex(IndexSpec{Columns: columns, Unique: unique})
+}
+
+// CreateIndexes creates the indexes described by specs on a table, like the
+// indexes of CreateTable. The table of the store is used when table is empty.
+func (dfs DFStore) CreateIndexes(ctx context.Context, table string, specs ...IndexSpec) error {
+	dfs.Ctx = ctx
+	t := dfs.withTable(table)
+	for _, spec := range specs {
+		if err := t.createIndex(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dfs DFStore) createIndex(spec IndexSpec) error {
+	if len(spec.Columns) < 1 {
+		return fmt.Errorf("index needs at least one column")
+	}
+	name := spec.indexName(dfs.TableName)
+	switch dfs.Kind {
+	case "postgres":
+		if dfs.PostgresClient == nil {
+			return fmt.Errorf("PostgresClient not initialized")
+		}
+		unique := ""
+		if spec.Unique {
+			unique = "UNIQUE "
+		}
+		qStr := fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s ON %s (%s)",
+			unique, name, dfs.TableName, strings.Join(spec.Columns, ","))
+		dfs.debug("postgres create index", "table", dfs.TableName, "sql", qStr)
+		_, err := dfs.postgresExecer().ExecContext(dfs.Ctx, qStr)
+		return err
+	case "mongodb":
+		if dfs.MongodbClient == nil {
+			return fmt.Errorf("MongodbClient not initialized")
+		}
+		keys := bson.D{}
+		for _, col := range spec.Columns {
+			keys = append(keys, bson.E{Key: col, Value: 1})
+		}
+		model := mongo.IndexModel{
+			Keys:    keys,
+			Options: options.Index().SetName(name).SetUnique(spec.Unique),
+		}
+		collection := dfs.MongodbClient.Database(dfs.DBName).Collection(dfs.TableName)
+		res, err := collection.Indexes().CreateOne(dfs.Ctx, model)
+		dfs.debug("mongodb create index", "table", dfs.TableName, "index", res)
+		return err
+	case "redis":
+		if len(spec.Columns) != 1 || spec.Unique {
+			return fmt.Errorf("redis supports only non unique single column indexes")
+		}
+		kind := RedisIndexSet
+		if spec.Sorted {
+			kind = RedisIndexSorted
+		}
+		return dfs.RedisCreateIndex(dfs.Ctx, spec.Columns[0], kind)
+	default:
+		return fmt.Errorf("not supported: %v", dfs.Kind)
+	}
+}
+
+// DropIndex drops the named index of a table. The table of the store is used when
+// table is empty. Redis indexes are named after their column.
+func (dfs DFStore) DropIndex(ctx context.Context, table, name string) error {
+	dfs.Ctx = ctx
+	t := dfs.withTable(table)
+	switch dfs.Kind {
+	case "postgres":
+		if dfs.PostgresClient == nil {
+			return fmt.Errorf("PostgresClient not initialized")
+		}
+		qStr := "DROP INDEX IF EXISTS " + name
+		dfs.debug("postgres drop index", "sql", qStr)
+		_, err := dfs.postgresExecer().ExecContext(dfs.Ctx, qStr)
+		return err
+	case "mongodb":
+		if dfs.MongodbClient == nil {
+			return fmt.Errorf("MongodbClient not initialized")
+		}
+		collection := dfs.MongodbClient.Database(dfs.DBName).Collection(t.TableName)
+		_, err := collection.Indexes().DropOne(dfs.Ctx, name)
+		return err
+	case "redis":
+		return t.RedisDropIndex(ctx, name)
+	default:
+		return fmt.Errorf("not supported: %v", dfs.Kind)
+	}
+}
+
+// postgresIndexDef extracts the uniqueness, the key list and what follows it,
+// such as INCLUDE or WHERE, from a postgres index definition.
+var postgresIndexDef = regexp.MustCompile(`^CREATE (UNIQUE )?INDEX .+? ON .+? USING \w+ \((.*?)\)( .*)?$`)
+
+// postgresIndexColumns returns the uniqueness and the columns of a postgres
+// index definition. It returns false for the indexes IndexSpec cannot describe:
+// the indexes on expressions and the partial indexes.
+func postgresIndexColumns(def string) (bool, []string, bool) {
+	m := postgresIndexDef.FindStringSubmatch(def)
+	if m == nil || strings.ContainsAny(m[2], "()") || strings.Contains(m[3], " WHERE ") {
+		return false, nil, false
+	}
+	var columns []string
+	for _, key := range strings.Split(m[2], ",") {
+		// the column is followed by its operator class and ordering, if any
+		fields := strings.Fields(key)
+		if len(fields) == 0 {
+			return false, nil, false
+		}
+		columns = append(columns, strings.Trim(fields[0], `"`))
+	}
+	return m[1] != "", columns, true
+}
+
+// postgresIndexDefs returns the definitions of the indexes of the table, but for
+// the indexes of its constraints such as the primary key.
+func (dfs DFStore) postgresIndexDefs() ([]string, error) {
+	rows, err := dfs.postgresExecer().QueryContext(dfs.Ctx,
+		`SELECT indexdef FROM pg_indexes i WHERE tablename = $1 AND schemaname = current_schema()
+		AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conname = i.indexname) ORDER BY indexname`,
+		strings.ToLower(dfs.TableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var defs []string
+	for rows.Next() {
+		var def string
+		if err := rows.Scan(&def); err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, rows.Err()
+}
+
+// postgresRestoreIndexes creates again the indexes of a table replaced by
+// WriteReplaceTable whose columns are all in cNames.
+func (dfs DFStore) postgresRestoreIndexes(defs []string, cNames []string) error {
+	present := make(map[string]bool, len(cNames))
+	for _, col := range cNames {
+		present[strings.ToLower(col)] = true
+	}
+	for _, def := range defs {
+		// the indexes on expressions and the partial indexes are not checked
+		_, columns, keep := postgresIndexColumns(def)
+		for _, col := range columns {
+			keep = keep && present[col]
+		}
+		if !keep {
+			dfs.warn("postgres index dropped with its columns", "table", dfs.TableName, "index", def)
+			continue
+		}
+		dfs.debug("postgres restore index", "table", dfs.TableName, "sql", def)
+		if _, err := dfs.postgresExecer().ExecContext(dfs.Ctx, def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListIndexes returns the indexes of a table. The table of the store is used when table is empty.
+// The postgres indexes on expressions and the partial indexes, which IndexSpec
+// cannot describe, are not listed.
+func (dfs DFStore) ListIndexes(ctx context.Context, table string) ([]IndexSpec, error) {
+	dfs.Ctx = ctx
+	t := dfs.withTable(table)
+	var specs []IndexSpec
+	switch dfs.Kind {
+	case "postgres":
+		if dfs.PostgresClient == nil {
+			return nil, fmt.Errorf("PostgresClient not initialized")
+		}
+		rows, err := dfs.postgresExecer().QueryContext(dfs.Ctx,
+			"SELECT indexname, indexdef FROM pg_indexes WHERE tablename = $1 AND schemaname = current_schema() ORDER BY indexname",
+			strings.ToLower(t.TableName))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name, def string
+			if err := rows.Scan(&name, &def); err != nil {
+				return nil, err
+			}
+			unique, columns, ok := postgresIndexColumns(def)
+			if !ok {
+				dfs.warn("postgres index on expressions or partial not listed", "table", t.TableName, "index", def)
+				continue
+			}
+			specs = append(specs, IndexSpec{Name: name, Columns: columns, Unique: unique})
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	case "mongodb":
+		if dfs.MongodbClient == nil {
+			return nil, fmt.Errorf("MongodbClient not initialized")
+		}
+		collection := dfs.MongodbClient.Database(dfs.DBName).Collection(t.TableName)
+		found, err := collection.Indexes().ListSpecifications(dfs.Ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range found {
+			spec := IndexSpec{Name: f.Name, Unique: f.Unique != nil && *f.Unique}
+			elems, err := f.KeysDocument.Elements()
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range elems {
+				spec.Columns = append(spec.Columns, e.Key())
+			}
+			specs = append(specs, spec)
+		}
+	case "redis":
+		indexes, err := t.RedisListIndexes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for col, kind := range indexes {
+			specs = append(specs, IndexSpec{Name: col, Columns: []string{col}, Sorted: kind == RedisIndexSorted})
+		}
+		sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	default:
+		return nil, fmt.Errorf("not supported: %v", dfs.Kind)
+	}
+	return specs, nil
+}
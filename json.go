@@ -0,0 +1,685 @@
+package dfstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-gota/gota/dataframe"
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// JSONOptions controls WriteJSON and ReadJSON.
+type JSONOptions struct {
+	// Separator joins the names of nested fields into the column names of
+	// postgres and redis tables, such as address.city. It is "." by default,
+	// "_" for postgres whose unquoted column names cannot hold dots.
+	// WriteJSON records the paths of these columns, which ReadJSON nests
+	// again, so that other column names holding the separator stay as they
+	// are. Mongodb keeps nested objects as they are.
+	Separator string
+	// Columns are the columns written by ReadJSON, all the columns by default.
+	Columns []string
+	// Types are type hints for the columns written by WriteJSON, taking
+	// precedence over the types of the JSON values and of the store.
+	Types TypeMapping
+	// Write controls the writes of WriteJSON, which writes the objects in batches
+	// of Write.BatchSize. WriteReplaceTable and WriteErrorIfExists apply to the
+	// first batch, the following ones are appended.
+	Write WriteOptions
+	// BatchSize is the number of rows read at a time by ReadJSON, DefaultBatchSize when 0.
+	BatchSize int
+}
+
+// separator returns the separator of nested field names for the store.
+func (opts JSONOptions) separator(kind string) string {
+	if opts.Separator != "" {
+		return opts.Separator
+	}
+	if kind == "postgres" {
+		return "_"
+	}
+	return "."
+}
+
+// WriteJSON reads JSON objects, either a JSON array of objects or newline
+// delimited objects (NDJSON), and writes them to a table, the table of the store
+// when table is empty. It returns the number of objects written. Mongodb stores
+// the objects as documents, with their nested objects and arrays. Postgres and
+// redis store nested fields in columns named by their path, arrays as JSON text,
+// with the types of the JSON values unless given by the types of the store or
+// of the options. The objects are written as they are read, a batch at a time.
+func (dfs DFStore) WriteJSON(ctx context.Context, r io.Reader, table string, opts JSONOptions) (n int, err error) {
+	dfs = dfs.withTable(table)
+	dfs.Ctx = ctx
+	start := time.Now()
+	defer func() {
+		args := []interface{}{"kind", dfs.Kind, "table", dfs.TableName, "rows", n, "duration", time.Since(start)}
+		if err != nil {
+			dfs.log(LevelError, "write json", append(args, "error", err)...)
+			return
+		}
+		dfs.log(LevelInfo, "write json", args...)
+	}()
+	next, err := jsonObjects(r)
+	if err != nil {
+		return 0, err
+	}
+	wopts := opts.Write
+	batchSize := wopts.batchSize()
+	var docs []bson.D
+	flush := func() error {
+		if len(docs) == 0 {
+			return nil
+		}
+		var err error
+		if dfs.Kind == "mongodb" {
+			err = dfs.inTransaction(func(t DFStore) error { return t.mongodbWriteDocuments(docs, wopts) })
+			err = unwrapMaybeApplied(err)
+		} else {
+			records, types, paths := flattenDocuments(docs, opts.separator(dfs.Kind))
+			t := dfs
+			t.opts.Types = mergeTypes(types, dfs.opts.Types, opts.Types)
+			err = t.WriteRecordsWithOptions(ctx, records, wopts)
+			if err == nil {
+				err = t.recordJSONPaths(paths, wopts.Mode == WriteReplaceTable)
+			}
+			if err == nil && dfs.Kind == "redis" {
+				recorded := make(TypeMapping, len(records[0]))
+				for _, col := range records[0] {
+					if typ, ok := t.opts.Types[col]; ok {
+						recorded[col] = typ
+					}
+				}
+				err = t.redisRecordTypes(recorded, wopts.Mode == WriteReplaceTable)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		wopts = wopts.next()
+		n += len(docs)
+		docs = docs[:0]
+		return nil
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		doc, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, fmt.Errorf("object %d: %v", n+len(docs)+1, err)
+		}
+		docs = append(docs, doc)
+		if len(docs) == batchSize {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, flush()
+}
+
+// jsonObjects returns a function reading the next object of a JSON array of
+// objects or of a stream of objects, which returns io.EOF after the last one.
+func jsonObjects(r io.Reader) (func() (bson.D, error), error) {
+	br := bufio.NewReader(r)
+	// skip the spaces to find out whether the input is an array
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			return func() (bson.D, error) { return nil, io.EOF }, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !unicode.IsSpace(c) {
+			br.UnreadRune()
+			break
+		}
+	}
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	array := false
+	if c, _ := br.Peek(1); len(c) == 1 && c[0] == '[' {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		array = true
+	}
+	return func() (bson.D, error) {
+		if array && !dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		v, err := decodeJSONValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		doc, ok := v.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("not an object")
+		}
+		return doc, nil
+	}, nil
+}
+
+// decodeJSONValue decodes the next JSON value, objects as bson.D to keep the
+// order of their fields, arrays as bson.A, and numbers as int64 when they are
+// integers and float64 otherwise.
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			doc := bson.D{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				doc = append(doc, bson.E{Key: key.(string), Value: v})
+			}
+			_, err := dec.Token()
+			return doc, err
+		case '[':
+			a := bson.A{}
+			for dec.More() {
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, v)
+			}
+			_, err := dec.Token()
+			return a, err
+		}
+		return nil, fmt.Errorf("unexpected %v", t)
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+	default:
+		return t, nil
+	}
+}
+
+// flattenDocuments returns the records of documents, whose columns are the
+// paths of their fields in the order they appear, the types of the values of
+// the columns, and the paths of the columns of nested fields. Arrays are JSON
+// text, null and missing values empty strings.
+func flattenDocuments(docs []bson.D, sep string) ([][]string, TypeMapping, map[string][]string) {
+	var header []string
+	index := make(map[string]int)
+	types := make(TypeMapping)
+	paths := make(map[string][]string)
+	rows := make([]map[string]string, len(docs))
+	var flatten func(row map[string]string, doc bson.D, path []string)
+	flatten = func(row map[string]string, doc bson.D, path []string) {
+		for _, e := range doc {
+			fieldPath := append(path[:len(path):len(path)], e.Key)
+			col := strings.Join(fieldPath, sep)
+			if nested, ok := e.Value.(bson.D); ok {
+				flatten(row, nested, fieldPath)
+				continue
+			}
+			if _, ok := index[col]; !ok {
+				index[col] = len(header)
+				header = append(header, col)
+			}
+			if len(fieldPath) > 1 {
+				paths[col] = fieldPath
+			}
+			var t ColumnType
+			switch v := e.Value.(type) {
+			case nil:
+				continue
+			case int64:
+				t = TypeInt
+				row[col] = strconv.FormatInt(v, 10)
+			case float64:
+				t = TypeFloat
+				row[col] = strconv.FormatFloat(v, 'g', -1, 64)
+			case bool:
+				t = TypeBool
+				row[col] = strconv.FormatBool(v)
+			case string:
+				t = TypeString
+				row[col] = v
+			default:
+				t = TypeString
+				row[col] = jsonText(v)
+			}
+			switch prev := types[col]; {
+			case prev == "" || prev == t:
+				types[col] = t
+			case prev == TypeInt && t == TypeFloat || prev == TypeFloat && t == TypeInt:
+				types[col] = TypeFloat
+			default:
+				types[col] = TypeString
+			}
+		}
+	}
+	for i, doc := range docs {
+		rows[i] = make(map[string]string)
+		flatten(rows[i], doc, nil)
+	}
+	records := make([][]string, 0, len(docs)+1)
+	records = append(records, header)
+	for _, row := range rows {
+		rec := make([]string, len(header))
+		for j, col := range header {
+			rec[j] = row[col]
+		}
+		records = append(records, rec)
+	}
+	return records, types, paths
+}
+
+// redisJSONPathsKey returns the key of the hash of column name to field path of
+// the columns of a redis table written from nested fields by WriteJSON.
+func redisJSONPathsKey(table string) string {
+	return "jsonpaths:" + table
+}
+
+// recordJSONPaths records the field paths of the columns written from nested
+// fields, as JSON arrays, in postgres column comments or next to a redis table,
+// replacing the paths recorded before when replace is set.
+func (dfs DFStore) recordJSONPaths(paths map[string][]string, replace bool) error {
+	switch dfs.Kind {
+	case "postgres":
+		for col, path := range paths {
+			qStr := fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s", dfs.TableName, col, pq.QuoteLiteral(jsonText(path)))
+			dfs.debug("postgres json path", "table", dfs.TableName, "sql", qStr)
+			if _, err := dfs.postgresExecer().ExecContext(dfs.Ctx, qStr); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "redis":
+		fields := make(map[string]interface{}, len(paths))
+		for col, path := range paths {
+			fields[col] = jsonText(path)
+		}
+		pipe := dfs.RedisClient.TxPipeline()
+		if replace {
+			pipe.Del(redisJSONPathsKey(dfs.TableName))
+		}
+		if len(fields) > 0 {
+			pipe.HMSet(redisJSONPathsKey(dfs.TableName), fields)
+		}
+		return contextDo(dfs.Ctx, func() error {
+			_, err := pipe.Exec()
+			return err
+		})
+	}
+	return nil
+}
+
+// jsonPaths returns the field paths recorded by WriteJSON for the columns of
+// the table written from nested fields.
+func (dfs DFStore) jsonPaths() (map[string][]string, error) {
+	recorded := make(map[string]string)
+	switch dfs.Kind {
+	case "postgres":
+		qStr := "SELECT a.attname, col_description(a.attrelid, a.attnum) FROM pg_attribute a " +
+			"WHERE a.attrelid = to_regclass($1) AND a.attnum > 0 AND NOT a.attisdropped " +
+			"AND col_description(a.attrelid, a.attnum) IS NOT NULL"
+		dfs.debug("postgres json paths", "table", dfs.TableName, "sql", qStr)
+		rows, err := dfs.postgresExecer().QueryContext(dfs.Ctx, qStr, strings.ToLower(dfs.TableName))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name, comment string
+			if err := rows.Scan(&name, &comment); err != nil {
+				return nil, err
+			}
+			recorded[name] = comment
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	case "redis":
+		err := contextDo(dfs.Ctx, func() error {
+			var err error
+			recorded, err = dfs.RedisClient.HGetAll(redisJSONPathsKey(dfs.TableName)).Result()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	paths := make(map[string][]string, len(recorded))
+	for col, text := range recorded {
+		var path []string
+		// comments not written by WriteJSON are not paths
+		if json.Unmarshal([]byte(text), &path) == nil && len(path) > 1 {
+			paths[col] = path
+		}
+	}
+	return paths, nil
+}
+
+// mongodbWriteDocuments writes documents with the write mode of opts. The keys
+// of WriteUpsert are field paths, the first field of each document by default.
+func (dfs DFStore) mongodbWriteDocuments(docs []bson.D, opts WriteOptions) error {
+	if dfs.MongodbClient == nil {
+		return fmt.Errorf("MongodbClient not initialized")
+	}
+	collection := dfs.MongodbClient.Database(dfs.DBName).Collection(dfs.TableName)
+	batchSize := opts.batchSize()
+	switch opts.Mode {
+	case WriteReplaceTable:
+		if _, err := collection.DeleteMany(dfs.mongoCtx(), bson.D{}); err != nil {
+			return err
+		}
+	case WriteErrorIfExists:
+		n, err := collection.CountDocuments(dfs.mongoCtx(), bson.D{}, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("table %s already has records", dfs.TableName)
+		}
+	case WriteUpsert:
+		models := make([]mongo.WriteModel, 0, len(docs))
+		for i, doc := range docs {
+			keys := opts.Keys
+			if len(keys) == 0 && len(doc) > 0 {
+				keys = []string{doc[0].Key}
+			}
+			filter := bson.D{}
+			for _, key := range keys {
+				v, ok := documentPath(doc, key)
+				if !ok {
+					return fmt.Errorf("object %d has no key %s", i+1, key)
+				}
+				filter = append(filter, bson.E{Key: key, Value: v})
+			}
+			if len(filter) == 0 {
+				return fmt.Errorf("object %d has no key", i+1)
+			}
+			models = append(models, mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(doc).SetUpsert(true))
+		}
+		for start := 0; start < len(models); start += batchSize {
+			end := start + batchSize
+			if end > len(models) {
+				end = len(models)
+			}
+			if _, err := collection.BulkWrite(dfs.mongoCtx(), models[start:end]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	dfs.debug("mongodb insert documents", "table", dfs.TableName, "rows", len(docs))
+	for start := 0; start < len(docs); start += batchSize {
+		end := start + batchSize
+		if end > len(docs) {
+			end = len(docs)
+		}
+		batch := make([]interface{}, end-start)
+		for i, doc := range docs[start:end] {
+			batch[i] = doc
+		}
+		if _, err := collection.InsertMany(dfs.mongoCtx(), batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// documentPath returns the value of the field at a dotted path of a document.
+func documentPath(doc bson.D, path string) (interface{}, bool) {
+	name, rest := path, ""
+	if i := strings.Index(path, "."); i >= 0 {
+		name, rest = path[:i], path[i+1:]
+	}
+	for _, e := range doc {
+		if e.Key != name {
+			continue
+		}
+		if rest == "" {
+			return e.Value, true
+		}
+		if nested, ok := e.Value.(bson.D); ok {
+			return documentPath(nested, rest)
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+// ReadJSON writes the rows of a table matching the filters to w as newline
+// delimited JSON objects (NDJSON), the table of the store when table is empty,
+// and returns the number of objects written. The filters without comparator are
+// ignored. Mongodb documents are written with their nested objects, without
+// their _id. The columns of postgres and redis tables written from nested
+// fields by WriteJSON become nested objects again, the other columns are fields
+// named by the columns, and their values have the types of the columns. The
+// rows are read a batch at a time in the key order of the table.
+func (dfs DFStore) ReadJSON(ctx context.Context, w io.Writer, table string, filters []dataframe.F, opts JSONOptions) (n int, err error) {
+	dfs = dfs.withTable(table)
+	dfs.Ctx = ctx
+	start := time.Now()
+	defer func() {
+		args := []interface{}{"kind", dfs.Kind, "table", dfs.TableName, "rows", n, "duration", time.Since(start)}
+		if err != nil {
+			dfs.log(LevelError, "read json", append(args, "error", err)...)
+			return
+		}
+		dfs.log(LevelInfo, "read json", args...)
+	}()
+	bw := bufio.NewWriter(w)
+	batchSize := WriteOptions{BatchSize: opts.BatchSize}.batchSize()
+
+	if dfs.Kind == "mongodb" {
+		if dfs, err = dfs.withFilterTypes(filters); err != nil {
+			return 0, err
+		}
+		var projection bson.D
+		if len(opts.Columns) > 0 {
+			projection = bson.D{}
+			for _, col := range opts.Columns {
+				projection = append(projection, bson.E{Key: col, Value: 1})
+			}
+		}
+		after := ""
+		for {
+			if err := ctx.Err(); err != nil {
+				return n, err
+			}
+			docs, next, done, err := dfs.mongodbPage(filters, projection, after, batchSize)
+			if err != nil {
+				return n, err
+			}
+			for _, doc := range docs {
+				out := make(bson.D, 0, len(doc))
+				for _, e := range doc {
+					if e.Key != "_id" {
+						out = append(out, e)
+					}
+				}
+				writeJSONValue(bw, out)
+				bw.WriteString("\n")
+			}
+			n += len(docs)
+			if err := bw.Flush(); err != nil {
+				return n, err
+			}
+			if done || next == "" {
+				return n, nil
+			}
+			after = next
+		}
+	}
+
+	schema, err := dfs.DescribeTable(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = schema.Columns
+	}
+	stored, err := dfs.columnTypes(columns)
+	if err != nil {
+		return 0, err
+	}
+	types := mergeTypes(dfs.opts.Types, stored)
+	paths, err := dfs.jsonPaths()
+	if err != nil {
+		return 0, err
+	}
+	after := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		rows, next, done, err := dfs.copyPage(columns, schema.Columns[0], filters, after, batchSize)
+		if err != nil {
+			return n, err
+		}
+		for _, row := range rows {
+			doc := bson.D{}
+			for j, col := range columns {
+				path, ok := paths[col]
+				if !ok {
+					path = []string{col}
+				}
+				doc = setDocumentPath(doc, path, types.value(col, row[j]))
+			}
+			writeJSONValue(bw, doc)
+			bw.WriteString("\n")
+		}
+		n += len(rows)
+		if err := bw.Flush(); err != nil {
+			return n, err
+		}
+		if done || next == "" {
+			return n, nil
+		}
+		after = next
+	}
+}
+
+// setDocumentPath sets the field at a path of a document, adding the nested
+// objects of the path, and returns the document. A field is set once: when
+// the objects were written with a value and with nested fields at the same
+// name, the empty one of the two is dropped.
+func setDocumentPath(doc bson.D, path []string, v interface{}) bson.D {
+	for i, e := range doc {
+		if e.Key != path[0] {
+			continue
+		}
+		nested, ok := e.Value.(bson.D)
+		switch {
+		case ok && len(path) > 1:
+			doc[i].Value = setDocumentPath(nested, path[1:], v)
+		case len(path) > 1 && isEmptyJSONValue(e.Value):
+			doc[i].Value = setDocumentPath(bson.D{}, path[1:], v)
+		case len(path) == 1 && ok && !isEmptyJSONValue(v):
+			doc[i].Value = v
+		}
+		return doc
+	}
+	if len(path) == 1 {
+		return append(doc, bson.E{Key: path[0], Value: v})
+	}
+	return append(doc, bson.E{Key: path[0], Value: setDocumentPath(bson.D{}, path[1:], v)})
+}
+
+// isEmptyJSONValue reports whether a value read from a column is null or empty.
+func isEmptyJSONValue(v interface{}) bool {
+	return v == nil || v == ""
+}
+
+// jsonText returns the JSON text of a value.
+func jsonText(v interface{}) string {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	writeJSONValue(bw, v)
+	bw.Flush()
+	return buf.String()
+}
+
+// writeJSONValue writes a value decoded from JSON or from mongodb as JSON,
+// keeping the order of the fields of documents. ObjectIDs are written as hex
+// strings, dates as RFC 3339 strings, decimals as strings, and the floats JSON
+// cannot hold as null.
+func writeJSONValue(w *bufio.Writer, v interface{}) {
+	switch v := v.(type) {
+	case bson.D:
+		w.WriteString("{")
+		for i, e := range v {
+			if i > 0 {
+				w.WriteString(",")
+			}
+			writeJSONValue(w, e.Key)
+			w.WriteString(":")
+			writeJSONValue(w, e.Value)
+		}
+		w.WriteString("}")
+	case bson.A:
+		writeJSONArray(w, v)
+	case []interface{}:
+		writeJSONArray(w, v)
+	case primitive.ObjectID:
+		writeJSONValue(w, v.Hex())
+	case primitive.DateTime:
+		writeJSONValue(w, v.Time().UTC().Format(time.RFC3339Nano))
+	case primitive.Decimal128:
+		writeJSONValue(w, v.String())
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			w.WriteString("null")
+			return
+		}
+		w.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			b = []byte("null")
+		}
+		w.Write(b)
+	}
+}
+
+func writeJSONArray(w *bufio.Writer, a []interface{}) {
+	w.WriteString("[")
+	for i, e := range a {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		writeJSONValue(w, e)
+	}
+	w.WriteString("]")
+}
@@ -0,0 +1,99 @@
+package dfstore
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger receives the diagnostics of a store. Each method takes a message
+// followed by alternating keys and values, like log/slog, so that a
+// *slog.Logger can be passed as is. The store is silent without a logger.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// Level is the severity of a log record, with the values used by log/slog.
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// nopLogger discards all records.
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// textLogger writes records at or above its level as key=value lines.
+type textLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+}
+
+// NewTextLogger returns a Logger writing the records at or above level to w,
+// one line per record in the key=value format of slog.TextHandler.
+func NewTextLogger(w io.Writer, level Level) Logger {
+	return &textLogger{w: w, level: level}
+}
+
+func (l *textLogger) Debug(msg string, args ...interface{}) { l.log(LevelDebug, msg, args) }
+func (l *textLogger) Info(msg string, args ...interface{})  { l.log(LevelInfo, msg, args) }
+func (l *textLogger) Warn(msg string, args ...interface{})  { l.log(LevelWarn, msg, args) }
+func (l *textLogger) Error(msg string, args ...interface{}) { l.log(LevelError, msg, args) }
+
+func (l *textLogger) log(level Level, msg string, args []interface{}) {
+	if level < l.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("time=" + time.Now().Format(time.RFC3339Nano))
+	b.WriteString(" level=" + level.String())
+	b.WriteString(" msg=" + logQuote(msg))
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			b.WriteString(" !BADKEY=" + logQuote(fmt.Sprint(args[i])))
+			break
+		}
+		b.WriteString(" " + fmt.Sprint(args[i]) + "=" + logQuote(fmt.Sprint(args[i+1])))
+	}
+	b.WriteString("\n")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+// logQuote quotes values that would not read back as a single value.
+func logQuote(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,192 @@
+package dfstore
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-gota/gota/dataframe"
+)
+
+// redacted replaces the credentials and sensitive values in the log records.
+const redacted = "xxxxx"
+
+// SensitiveColumns matches the names of the columns whose values are redacted
+// in the log records. WithRedactColumns adds columns to it.
+var SensitiveColumns = regexp.MustCompile(`(?i)(passw(or)?d|secret|token|api_?key|credential|ssn)`)
+
+// log sends a record to the logger of the store. The values of args, which
+// alternate keys and values, are redacted, and so are the values of keys
+// naming sensitive columns.
+func (dfs DFStore) log(level Level, msg string, args ...interface{}) {
+	if dfs.logger == nil {
+		return
+	}
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		if i%2 == 0 {
+			out[i] = arg
+			continue
+		}
+		out[i] = dfs.redact(arg)
+		if key, ok := args[i-1].(string); ok && dfs.isSensitive(key) {
+			out[i] = redacted
+		}
+	}
+	switch level {
+	case LevelDebug:
+		dfs.logger.Debug(msg, out...)
+	case LevelInfo:
+		dfs.logger.Info(msg, out...)
+	case LevelWarn:
+		dfs.logger.Warn(msg, out...)
+	default:
+		dfs.logger.Error(msg, out...)
+	}
+}
+
+func (dfs DFStore) debug(msg string, args ...interface{}) { dfs.log(LevelDebug, msg, args...) }
+func (dfs DFStore) warn(msg string, args ...interface{})  { dfs.log(LevelWarn, msg, args...) }
+
+// redact returns a loggable copy of v without credentials and sensitive values.
+func (dfs DFStore) redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case bool, int, int64, float64, time.Duration, Level, WriteMode:
+		return v
+	case string:
+		return dfs.scrub(v)
+	case *url.URL:
+		return v.Redacted()
+	case DFStore:
+		return dfs.scrub(fmt.Sprintf("DFStore{Kind:%s Host:%s Port:%s User:%s Password:%s DBName:%s TableName:%s Q:%s}",
+			v.Kind, v.Host, v.Port, v.User, redacted, v.DBName, v.TableName, v.Q))
+	case []string:
+		out := make([]string, len(v))
+		for i, s := range v {
+			out[i] = dfs.scrub(s)
+		}
+		return out
+	case map[string]string:
+		out := make(map[string]string, len(v))
+		for col, val := range v {
+			out[col] = dfs.scrub(val)
+			if dfs.isSensitive(col) {
+				out[col] = redacted
+			}
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for col, val := range v {
+			out[col] = dfs.redact(val)
+			if dfs.isSensitive(col) {
+				out[col] = redacted
+			}
+		}
+		return out
+	case [][]string:
+		return dfs.redactRecords(v)
+	case []dataframe.F:
+		out := make([]string, len(v))
+		for i, f := range v {
+			val := fmt.Sprintf("%v", f.Comparando)
+			if dfs.isSensitive(f.Colname) {
+				val = redacted
+			}
+			out[i] = dfs.scrub(fmt.Sprintf("%s %s %s", f.Colname, f.Comparator, val))
+		}
+		return out
+	default:
+		return dfs.scrub(fmt.Sprintf("%v", v))
+	}
+}
+
+// redactRecords redacts the values of the sensitive columns of records whose
+// first row holds the column names.
+func (dfs DFStore) redactRecords(records [][]string) [][]string {
+	if len(records) < 1 {
+		return records
+	}
+	var sensitive []int
+	for j, col := range records[0] {
+		if dfs.isSensitive(col) {
+			sensitive = append(sensitive, j)
+		}
+	}
+	out := make([][]string, len(records))
+	for i, row := range records {
+		out[i] = make([]string, len(row))
+		for j, val := range row {
+			out[i][j] = dfs.scrub(val)
+		}
+		if i == 0 {
+			continue
+		}
+		for _, j := range sensitive {
+			if j < len(row) {
+				out[i][j] = redacted
+			}
+		}
+	}
+	return out
+}
+
+// redactRow returns the row as a map of column name to value for the log records.
+func (dfs DFStore) redactRow(cNames, row []string) map[string]string {
+	out := make(map[string]string, len(cNames))
+	for j, col := range cNames {
+		if j < len(row) {
+			out[col] = row[j]
+		}
+	}
+	return dfs.redact(out).(map[string]string)
+}
+
+// isSensitive reports whether the values of a column are redacted.
+func (dfs DFStore) isSensitive(col string) bool {
+	return SensitiveColumns.MatchString(col) || dfs.redactColumns[strings.ToLower(col)]
+}
+
+// scrub replaces the passwords of the store found in s, for example in a URL
+// or in an error returned by a driver.
+func (dfs DFStore) scrub(s string) string {
+	for _, secret := range dfs.secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	return s
+}
+
+// recordCount returns the number of rows of records, not counting the column names.
+func recordCount(records [][]string) int {
+	if len(records) < 1 {
+		return 0
+	}
+	return len(records) - 1
+}
+
+// redactSecrets returns the passwords to redact, in the forms they take in a URL.
+func redactSecrets(u *url.URL, passwords ...string) []string {
+	if p, ok := u.User.Password(); ok {
+		passwords = append(passwords, p)
+	}
+	var secrets []string
+	for _, p := range passwords {
+		if p == "" {
+			continue
+		}
+		secrets = append(secrets, p)
+		if e := url.QueryEscape(p); e != p {
+			secrets = append(secrets, e)
+		}
+		if e := url.PathEscape(p); e != p {
+			secrets = append(secrets, e)
+		}
+	}
+	return secrets
+}
@@ -0,0 +1,53 @@
+package dfstore
+
+import "time"
+
+// Metrics receives a measurement of every operation of a store.
+type Metrics interface {
+	Observe(m OperationMetrics)
+}
+
+// OperationMetrics measures one operation of a store.
+type OperationMetrics struct {
+	// Op is the operation: connect, read or write.
+	Op    string
+	Kind  string
+	Table string
+	Rows  int
+	// Bytes is the size of the values of the rows.
+	Bytes int
+	// Duration is the time taken by the operation, including its retries.
+	Duration time.Duration
+	// Err is the error the operation failed with, nil on success.
+	Err error
+}
+
+// observeOp logs the outcome of an operation on the records of the table of the
+// store, at info level or at error level when it failed, and reports it to the metrics.
+func (dfs DFStore) observeOp(op string, start time.Time, records [][]string, err error, args ...interface{}) {
+	elapsed := time.Since(start)
+	rows := recordCount(records)
+	if dfs.opts.Metrics != nil {
+		dfs.opts.Metrics.Observe(OperationMetrics{Op: op, Kind: dfs.Kind, Table: dfs.TableName,
+			Rows: rows, Bytes: recordBytes(records), Duration: elapsed, Err: err})
+	}
+	args = append([]interface{}{"kind", dfs.Kind, "table", dfs.TableName, "rows", rows}, args...)
+	args = append(args, "duration", elapsed)
+	if err != nil {
+		dfs.health.recordError(err)
+		dfs.log(LevelError, op, append(args, "error", err)...)
+		return
+	}
+	dfs.log(LevelInfo, op, args...)
+}
+
+// recordBytes returns the size of the values of records, without the column names.
+func recordBytes(records [][]string) int {
+	n := 0
+	for i := 1; i < len(records); i++ {
+		for _, v := range records[i] {
+			n += len(v)
+		}
+	}
+	return n
+}
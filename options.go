@@ -0,0 +1,98 @@
+package dfstore
+
+// DefaultReadLimit is the number of rows read when a read is given no limit and
+// Options.DefaultLimit is zero.
+const DefaultReadLimit = 1000
+
+// Options holds the configuration of a store, set by the Option functions
+// passed to New and NewFromProfile.
+type Options struct {
+	// TLS enables TLS connections to the backend.
+	TLS *TLSOptions
+	// Credentials override the user and password of the URL. A redis user
+	// authenticates with a redis 6 ACL user instead of the default user.
+	Credentials *Credentials
+	// Logger receives the diagnostics of the store, which is silent without one.
+	// The URL passwords and the values of sensitive columns are redacted.
+	Logger Logger
+	// RedactColumns names the columns whose values are redacted in the log
+	// records in addition to the ones matching SensitiveColumns.
+	RedactColumns []string
+	// Metrics receives a measurement of every operation.
+	Metrics Metrics
+	// Tracer starts the spans of the operations and of their phases.
+	Tracer Tracer
+	// Retry is the policy for operations failing with transient errors, one
+	// attempt by default.
+	Retry RetryPolicy
+	// DefaultLimit is the number of rows read when a read is given no limit,
+	// DefaultReadLimit when 0.
+	DefaultLimit int
+	// Types maps column names to the types stored by the backends, the
+	// columns not listed are strings.
+	Types TypeMapping
+}
+
+// defaultLimit returns the number of rows read when a read is given no limit,
+// applying the default.
+func (o Options) defaultLimit() int {
+	if o.DefaultLimit > 0 {
+		return o.DefaultLimit
+	}
+	return DefaultReadLimit
+}
+
+// Option sets an option of a store.
+type Option func(*Options)
+
+// WithTLS connects to the backend with TLS.
+func WithTLS(t TLSOptions) Option {
+	return func(o *Options) { o.TLS = &t }
+}
+
+// WithCredentials overrides the user and password of the URL.
+func WithCredentials(c Credentials) Option {
+	return func(o *Options) { o.Credentials = &c }
+}
+
+// WithLogger sends the diagnostics of the store to l.
+func WithLogger(l Logger) Option {
+	return func(o *Options) { o.Logger = l }
+}
+
+// WithRedactColumns redacts the values of the columns in the log records.
+func WithRedactColumns(columns ...string) Option {
+	return func(o *Options) { o.RedactColumns = append(o.RedactColumns, columns...) }
+}
+
+// WithMetrics sends a measurement of every operation to m.
+func WithMetrics(m Metrics) Option {
+	return func(o *Options) { o.Metrics = m }
+}
+
+// WithTracer traces the operations with t.
+func WithTracer(t Tracer) Option {
+	return func(o *Options) { o.Tracer = t }
+}
+
+// WithRetry sets the retry policy.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *Options) { o.Retry = p }
+}
+
+// WithDefaultLimit sets the number of rows read when a read is given no limit.
+func WithDefaultLimit(n int) Option {
+	return func(o *Options) { o.DefaultLimit = n }
+}
+
+// WithTypes sets the types of columns, adding to the types already set.
+func WithTypes(types TypeMapping) Option {
+	return func(o *Options) {
+		if o.Types == nil {
+			o.Types = make(TypeMapping, len(types))
+		}
+		for col, t := range types {
+			o.Types[col] = t
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package dfstore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the latency histogram.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics counts the operations of the stores it is passed to with
+// WithMetrics, by operation, backend and table, and exports them in the
+// Prometheus text format:
+//
+//	dfstore_operations_total             operations, failed or not
+//	dfstore_errors_total                 failed operations
+//	dfstore_rows_total                   rows read or written
+//	dfstore_bytes_total                  size of the values read or written
+//	dfstore_operation_duration_seconds   latency histogram
+//
+// It is an http.Handler serving the metrics to Prometheus scrapes.
+type PrometheusMetrics struct {
+	buckets []float64
+	mu      sync.Mutex
+	series  map[promLabels]*promSeries
+}
+
+type promLabels struct {
+	op, backend, table string
+}
+
+type promSeries struct {
+	ops, errors, rows, bytes uint64
+	// buckets count the operations taking up to each bucket bound
+	buckets []uint64
+	sum     float64
+}
+
+// NewPrometheusMetrics returns metrics with a latency histogram of the bucket
+// bounds in seconds, DefaultBuckets when none are given.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &PrometheusMetrics{buckets: buckets, series: make(map[promLabels]*promSeries)}
+}
+
+// Observe counts an operation.
+func (m *PrometheusMetrics) Observe(op OperationMetrics) {
+	labels := promLabels{op: op.Op, backend: op.Kind, table: op.Table}
+	seconds := op.Duration.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.series[labels]
+	if s == nil {
+		s = &promSeries{buckets: make([]uint64, len(m.buckets))}
+		m.series[labels] = s
+	}
+	s.ops++
+	if op.Err != nil {
+		s.errors++
+	}
+	s.rows += uint64(op.Rows)
+	s.bytes += uint64(op.Bytes)
+	s.sum += seconds
+	for i, le := range m.buckets {
+		if seconds <= le {
+			s.buckets[i]++
+		}
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	labels := make([]promLabels, 0, len(m.series))
+	series := make(map[promLabels]promSeries, len(m.series))
+	for l, s := range m.series {
+		labels = append(labels, l)
+		c := *s
+		c.buckets = append([]uint64(nil), s.buckets...)
+		series[l] = c
+	}
+	m.mu.Unlock()
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := labels[i], labels[j]
+		if a.op != b.op {
+			return a.op < b.op
+		}
+		if a.backend != b.backend {
+			return a.backend < b.backend
+		}
+		return a.table < b.table
+	})
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	counters := []struct {
+		name, help string
+		value      func(promSeries) uint64
+	}{
+		{"dfstore_operations_total", "Operations of the stores.", func(s promSeries) uint64 { return s.ops }},
+		{"dfstore_errors_total", "Failed operations of the stores.", func(s promSeries) uint64 { return s.errors }},
+		{"dfstore_rows_total", "Rows read or written.", func(s promSeries) uint64 { return s.rows }},
+		{"dfstore_bytes_total", "Size of the values read or written.", func(s promSeries) uint64 { return s.bytes }},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		for _, l := range labels {
+			fmt.Fprintf(cw, "%s{%s} %d\n", c.name, l, c.value(series[l]))
+		}
+	}
+	const hist = "dfstore_operation_duration_seconds"
+	fmt.Fprintf(cw, "# HELP %s Latency of the operations of the stores.\n# TYPE %s histogram\n", hist, hist)
+	for _, l := range labels {
+		s := series[l]
+		for i, le := range m.buckets {
+			fmt.Fprintf(cw, "%s_bucket{%s,le=\"%s\"} %d\n", hist, l, formatFloat(le), s.buckets[i])
+		}
+		fmt.Fprintf(cw, "%s_bucket{%s,le=\"+Inf\"} %d\n", hist, l, s.ops)
+		fmt.Fprintf(cw, "%s_sum{%s} %s\n", hist, l, formatFloat(s.sum))
+		fmt.Fprintf(cw, "%s_count{%s} %d\n", hist, l, s.ops)
+	}
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// String formats the labels of a series.
+func (l promLabels) String() string {
+	return fmt.Sprintf(`op="%s",backend="%s",table="%s"`,
+		escapeLabel(l.op), escapeLabel(l.backend), escapeLabel(l.table))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value of the text format.
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// countingWriter counts the bytes written and keeps the first error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
@@ -0,0 +1,361 @@
+package dfstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-gota/gota/dataframe"
+	"github.com/go-gota/gota/series"
+	"github.com/go-redis/redis"
+)
+
+// RedisIndexType is the kind of secondary index kept for a column of a redis table.
+type RedisIndexType string
+
+const (
+	// RedisIndexSet keeps a set of row numbers per column value and answers == and in filters.
+	RedisIndexSet RedisIndexType = "set"
+	// RedisIndexSorted keeps a sorted set of row numbers scored by the numeric column
+	// value and answers ==, in, <, <=, > and >= filters. Non numeric values are not indexed.
+	RedisIndexSorted RedisIndexType = "sorted"
+)
+
+// The index declarations of a table are kept in the hash indexes:<table>, mapping
+// the column name to its RedisIndexType. The index data is kept in
+//
+//	idx:<table>:<column>:<value>   set of row numbers, for RedisIndexSet
+//	zidx:<table>:<column>          sorted set of row numbers, for RedisIndexSorted
+
+func redisIndexesKey(table string) string {
+	return "indexes:" + table
+}
+
+func redisSetIndexKey(table, column, value string) string {
+	return "idx:" + table + ":" + column + ":" + value
+}
+
+func redisSortedIndexKey(table, column string) string {
+	return "zidx:" + table + ":" + column
+}
+
+// RedisCreateIndex declares a secondary index on a column of the table and builds
+// it from the rows already stored. The index is maintained by later writes.
+func (dfs DFStore) RedisCreateIndex(ctx context.Context, column string, kind RedisIndexType) error {
+	dfs.Ctx = ctx
+	if dfs.Kind != "redis" {
+		return fmt.Errorf("expect kind redis, got %s", dfs.Kind)
+	}
+	if dfs.RedisClient == nil {
+		return fmt.Errorf("RedisClient not initialized")
+	}
+	if kind != RedisIndexSet && kind != RedisIndexSorted {
+		return fmt.Errorf("unknown redis index type %s", kind)
+	}
+	if err := dfs.RedisDropIndex(ctx, column); err != nil {
+		return err
+	}
+	err := contextDo(dfs.Ctx, func() error {
+		return dfs.RedisClient.HSet(redisIndexesKey(dfs.TableName), column, string(kind)).Err()
+	})
+	if err != nil {
+		return err
+	}
+	indexes := map[string]string{column: string(kind)}
+	rowsKey := redisRowsKey(dfs.TableName)
+	for start := int64(0); ; start += redisReadBatch {
+		var ids []string
+		err := contextDo(dfs.Ctx, func() (err error) {
+			ids, err = dfs.RedisClient.ZRange(rowsKey, start, start+redisReadBatch-1).Result()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		pipe := dfs.RedisClient.Pipeline()
+		cmds := make([]*redis.StringCmd, len(ids))
+		for i, id := range ids {
+			cmds[i] = pipe.HGet(redisRowKey(dfs.TableName, id), column)
+		}
+		err = contextDo(dfs.Ctx, func() error {
+			_, err := pipe.Exec()
+			return err
+		})
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		pipe = dfs.RedisClient.TxPipeline()
+		for i, id := range ids {
+			val, err := cmds[i].Result()
+			if err != nil {
+				continue
+			}
+			redisIndexAdd(pipe, dfs.TableName, indexes, id, map[string]string{column: val})
+		}
+		err = contextDo(dfs.Ctx, func() error {
+			_, err := pipe.Exec()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// RedisDropIndex removes the secondary index of a column of the table.
+func (dfs DFStore) RedisDropIndex(ctx context.Context, column string) error {
+	dfs.Ctx = ctx
+	if dfs.Kind != "redis" {
+		return fmt.Errorf("expect kind redis, got %s", dfs.Kind)
+	}
+	if dfs.RedisClient == nil {
+		return fmt.Errorf("RedisClient not initialized")
+	}
+	keys, err := dfs.redisScanKeys(redisSetIndexKey(redisGlobEscape(dfs.TableName), redisGlobEscape(column), "*"))
+	if err != nil {
+		return err
+	}
+	keys = append(keys, redisSortedIndexKey(dfs.TableName, column))
+	return contextDo(dfs.Ctx, func() error {
+		if err := dfs.RedisClient.Del(keys...).Err(); err != nil {
+			return err
+		}
+		return dfs.RedisClient.HDel(redisIndexesKey(dfs.TableName), column).Err()
+	})
+}
+
+// RedisListIndexes returns the indexed columns of the table and their index types.
+func (dfs DFStore) RedisListIndexes(ctx context.Context) (map[string]RedisIndexType, error) {
+	dfs.Ctx = ctx
+	if dfs.Kind != "redis" {
+		return nil, fmt.Errorf("expect kind redis, got %s", dfs.Kind)
+	}
+	if dfs.RedisClient == nil {
+		return nil, fmt.Errorf("RedisClient not initialized")
+	}
+	var decl map[string]string
+	err := contextDo(dfs.Ctx, func() (err error) {
+		decl, err = dfs.RedisClient.HGetAll(redisIndexesKey(dfs.TableName)).Result()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	indexes := make(map[string]RedisIndexType, len(decl))
+	for col, kind := range decl {
+		indexes[col] = RedisIndexType(kind)
+	}
+	return indexes, nil
+}
+
+// redisGlobEscape escapes the glob characters of s, so that a SCAN pattern made
+// of table and column names matches these names literally.
+func redisGlobEscape(s string) string {
+	if !strings.ContainsAny(s, `*?[]\`) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// redisScanKeys returns all keys matching the pattern.
+func (dfs DFStore) redisScanKeys(match string) ([]string, error) {
+	var keys []string
+	var cursor uint64
+	for {
+		var found []string
+		err := contextDo(dfs.Ctx, func() (err error) {
+			found, cursor, err = dfs.RedisClient.Scan(cursor, match, 1000).Result()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, found...)
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
+// redisIndexAdd queues the index entries of the indexed columns found in row.
+func redisIndexAdd(pipe redis.Pipeliner, table string, indexes map[string]string, rowID string, row map[string]string) {
+	for col, kind := range indexes {
+		val, ok := row[col]
+		if !ok {
+			continue
+		}
+		switch RedisIndexType(kind) {
+		case RedisIndexSet:
+			pipe.SAdd(redisSetIndexKey(table, col, val), rowID)
+		case RedisIndexSorted:
+			score, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				continue
+			}
+			pipe.ZAdd(redisSortedIndexKey(table, col), redis.Z{Score: score, Member: rowID})
+		}
+	}
+}
+
+// redisIndexRemove queues the removal of the index entries of the indexed columns found in row.
+func redisIndexRemove(pipe redis.Pipeliner, table string, indexes map[string]string, rowID string, row map[string]string) {
+	for col, kind := range indexes {
+		val, ok := row[col]
+		if !ok {
+			continue
+		}
+		switch RedisIndexType(kind) {
+		case RedisIndexSet:
+			pipe.SRem(redisSetIndexKey(table, col, val), rowID)
+		case RedisIndexSorted:
+			pipe.ZRem(redisSortedIndexKey(table, col), rowID)
+		}
+	}
+}
+
+// redisIndexedRowIDs answers the filters that have a usable index and returns the
+// intersection of the matching row numbers, sorted. The boolean result is false when
+// no filter could use an index and the table has to be scanned.
+func (dfs DFStore) redisIndexedRowIDs(filters []dataframe.F) ([]string, bool, error) {
+	indexes, err := dfs.RedisClient.HGetAll(redisIndexesKey(dfs.TableName)).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(indexes) == 0 {
+		return nil, false, nil
+	}
+	var matched map[string]bool
+	used := false
+	for _, filt := range filters {
+		kind, ok := indexes[filt.Colname]
+		if !ok || filt.Comparator == "" {
+			continue
+		}
+		ids, ok, err := dfs.redisIndexLookup(filt, RedisIndexType(kind))
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			continue
+		}
+		used = true
+		next := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			if matched == nil || matched[id] {
+				next[id] = true
+			}
+		}
+		matched = next
+	}
+	if !used {
+		return nil, false, nil
+	}
+	result := make([]string, 0, len(matched))
+	for id := range matched {
+		result = append(result, id)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, _ := strconv.ParseInt(result[i], 10, 64)
+		b, _ := strconv.ParseInt(result[j], 10, 64)
+		return a < b
+	})
+	dfs.debug("redis index lookup", "table", dfs.TableName, "filters", filters, "rows", len(result))
+	return result, true, nil
+}
+
+// redisIndexLookup returns the row numbers matching one filter using the index of its
+// column. The boolean result is false when the index cannot answer the filter.
+func (dfs DFStore) redisIndexLookup(filt dataframe.F, kind RedisIndexType) ([]string, bool, error) {
+	values := comparandoStrings(filt.Comparando)
+	if len(values) == 0 {
+		return nil, true, nil
+	}
+	switch kind {
+	case RedisIndexSet:
+		switch filt.Comparator {
+		case series.Eq, series.In:
+			keys := make([]string, len(values))
+			for i, val := range values {
+				keys[i] = redisSetIndexKey(dfs.TableName, filt.Colname, val)
+			}
+			ids, err := dfs.RedisClient.SUnion(keys...).Result()
+			return ids, true, err
+		}
+	case RedisIndexSorted:
+		// scores are numeric, other values are answered by scanning the table
+		for _, val := range values {
+			if _, err := strconv.ParseFloat(val, 64); err != nil {
+				return nil, false, nil
+			}
+		}
+		key := redisSortedIndexKey(dfs.TableName, filt.Colname)
+		var ranges []redis.ZRangeBy
+		switch filt.Comparator {
+		case series.Eq, series.In:
+			for _, val := range values {
+				ranges = append(ranges, redis.ZRangeBy{Min: val, Max: val})
+			}
+		case series.Greater:
+			ranges = append(ranges, redis.ZRangeBy{Min: "(" + values[0], Max: "+inf"})
+		case series.GreaterEq:
+			ranges = append(ranges, redis.ZRangeBy{Min: values[0], Max: "+inf"})
+		case series.Less:
+			ranges = append(ranges, redis.ZRangeBy{Min: "-inf", Max: "(" + values[0]})
+		case series.LessEq:
+			ranges = append(ranges, redis.ZRangeBy{Min: "-inf", Max: values[0]})
+		default:
+			return nil, false, nil
+		}
+		var ids []string
+		for _, r := range ranges {
+			found, err := dfs.RedisClient.ZRangeByScore(key, r).Result()
+			if err != nil {
+				return nil, false, err
+			}
+			ids = append(ids, found...)
+		}
+		return ids, true, nil
+	}
+	return nil, false, nil
+}
+
+// comparandoStrings converts the comparando of a filter to a list of strings.
+func comparandoStrings(comparando interface{}) []string {
+	switch v := comparando.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		ss := make([]string, len(v))
+		for i, e := range v {
+			ss[i] = fmt.Sprintf("%v", e)
+		}
+		return ss
+	case []int:
+		ss := make([]string, len(v))
+		for i, e := range v {
+			ss[i] = strconv.Itoa(e)
+		}
+		return ss
+	case []float64:
+		ss := make([]string, len(v))
+		for i, e := range v {
+			ss[i] = strconv.FormatFloat(e, 'f', -1, 64)
+		}
+		return ss
+	default:
+		return []string{fmt.Sprintf("%v", comparando)}
+	}
+}
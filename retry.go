@@ -0,0 +1,161 @@
+package dfstore
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// RetryPolicy is the number of attempts made and the delay between them.
+// The zero value makes a single attempt.
+type RetryPolicy struct {
+	MaxAttempts int
+	// InitialBackoff is the delay after the first attempt, doubled after each
+	// following attempt up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter randomizes each delay by up to this fraction of it, from 0 to 1, so
+	// that clients failing together do not retry together.
+	Jitter float64
+}
+
+// DefaultRetryPolicy makes up to 4 attempts over about a second.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Jitter:         0.2,
+}
+
+// backoff returns the delay after n failed attempts.
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < n; i++ {
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(p.Jitter * (2*rand.Float64() - 1) * float64(d))
+	}
+	return d
+}
+
+// retry runs fn under the retry policy of the store until it succeeds, fails
+// with an error for which retryable is false, or the attempts are used up.
+// Each retry is logged at warn level.
+func (dfs DFStore) retry(op string, fn func() error, retryable func(error) bool) error {
+	p := dfs.opts.Retry
+	for n := 1; ; n++ {
+		err := fn()
+		if err == nil || n >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+		d := p.backoff(n)
+		dfs.warn("retry", "op", op, "kind", dfs.Kind, "table", dfs.TableName, "attempt", n,
+			"backoff", d, "error", err)
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-dfs.Ctx.Done():
+			t.Stop()
+			return err
+		}
+	}
+}
+
+// Retryable reports whether an error returned by a backend of the given kind is
+// transient, so that the operation may succeed when it is attempted again:
+// connection failures, postgres serialization failures and deadlocks, mongodb
+// errors labeled retryable and redis servers loading or failing over. Canceled
+// and expired contexts are not retryable.
+func Retryable(kind string, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	switch kind {
+	case "postgres":
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			switch pqErr.Code {
+			case "40001", // serialization_failure
+				"40P01", // deadlock_detected
+				"53300", // too_many_connections
+				"57P01", // admin_shutdown
+				"57P03": // cannot_connect_now
+				return true
+			}
+			// connection exceptions
+			return pqErr.Code.Class() == "08"
+		}
+	case "mongodb":
+		var sErr mongo.ServerError
+		if errors.As(err, &sErr) &&
+			(sErr.HasErrorLabel("RetryableWriteError") || sErr.HasErrorLabel("TransientTransactionError")) {
+			return true
+		}
+		var selErr topology.ServerSelectionError
+		if errors.As(err, &selErr) {
+			return true
+		}
+		return mongo.IsNetworkError(err)
+	case "redis":
+		for _, prefix := range []string{"LOADING ", "READONLY ", "CLUSTERDOWN ", "TRYAGAIN ", "MASTERDOWN "} {
+			if strings.HasPrefix(err.Error(), prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// retryable reports whether an error of the backend of the store is transient.
+func (dfs DFStore) retryable(err error) bool {
+	return Retryable(dfs.Kind, err)
+}
+
+// maybeAppliedError wraps the errors after which a write may have taken effect,
+// in part or in full: a failed commit, or a failure of a write made without a
+// transaction. Such writes are only retried when they are idempotent.
+type maybeAppliedError struct {
+	err error
+}
+
+func (e *maybeAppliedError) Error() string { return e.err.Error() }
+func (e *maybeAppliedError) Unwrap() error { return e.err }
+
+// maybeApplied wraps a non-nil error in a maybeAppliedError.
+func maybeApplied(err error) error {
+	if _, ok := err.(*maybeAppliedError); ok || err == nil {
+		return err
+	}
+	return &maybeAppliedError{err}
+}
+
+// unwrapMaybeApplied returns the error wrapped by a maybeAppliedError.
+func unwrapMaybeApplied(err error) error {
+	if e, ok := err.(*maybeAppliedError); ok {
+		return e.err
+	}
+	return err
+}
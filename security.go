@@ -0,0 +1,93 @@
+package dfstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSOptions configures TLS connections to the backends with PEM encoded files.
+type TLSOptions struct {
+	// CAFile holds the certificate authorities trusted for the server certificate.
+	// The system pool is used when it is empty, by postgres as well.
+	CAFile string
+	// CertFile and KeyFile hold the client certificate and its private key.
+	CertFile string
+	KeyFile  string
+	// ServerName is the name expected in the server certificate, the URL host by
+	// default. Postgres always expects the URL host, which lib/pq checks.
+	ServerName string
+	// InsecureSkipVerify disables the verification of the server certificate.
+	InsecureSkipVerify bool
+}
+
+// Credentials override the user and password given in the URL.
+type Credentials struct {
+	User     string
+	Password string
+	// AuthMechanism and AuthSource select the mongodb authentication, e.g. SCRAM-SHA-256.
+	AuthMechanism string
+	AuthSource    string
+}
+
+// Config returns the tls.Config for a server name, loading the CA and client certificates.
+func (t TLSOptions) Config(serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.ServerName != "" {
+		cfg.ServerName = t.ServerName
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// postgresSSLSettings returns the libpq settings for the TLS options. The sslmode
+// given in the URL takes precedence over the one derived from the options. Without
+// sslrootcert, lib/pq verifies the server certificate against the system pool.
+func (t TLSOptions) postgresSSLSettings(sslmode string) string {
+	if sslmode == "" {
+		sslmode = "verify-full"
+		if t.InsecureSkipVerify {
+			sslmode = "require"
+		}
+	}
+	settings := "sslmode=" + pqQuote(sslmode)
+	if t.CAFile != "" {
+		settings += " sslrootcert=" + pqQuote(t.CAFile)
+	}
+	if t.CertFile != "" {
+		settings += " sslcert=" + pqQuote(t.CertFile)
+	}
+	if t.KeyFile != "" {
+		settings += " sslkey=" + pqQuote(t.KeyFile)
+	}
+	return settings
+}
+
+// pqQuote quotes a value of a libpq connection string.
+func pqQuote(val string) string {
+	val = strings.ReplaceAll(val, `\`, `\\`)
+	val = strings.ReplaceAll(val, `'`, `\'`)
+	return "'" + val + "'"
+}
@@ -0,0 +1,335 @@
+package dfstore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gota/gota/dataframe"
+)
+
+// structField is a struct field stored in a column, described by a tag such as
+//
+//	Title string `dfstore:"title,string,pk"`
+//
+// naming the column, its type and whether it is a key of the table. The column
+// is the lowercased field name when the name is empty, the type follows the
+// field type when it is empty, and the fields tagged "-" are not stored.
+type structField struct {
+	index  []int
+	column string
+	typ    ColumnType
+	pk     bool
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// structFields returns the stored fields of a struct type, the key fields first
+// since postgres tables use their first column as the primary key.
+func structFields(t reflect.Type) ([]structField, error) {
+	var keys, others []structField
+	var walk func(t reflect.Type, index []int) error
+	walk = func(t reflect.Type, index []int) error {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag, tagged := f.Tag.Lookup("dfstore")
+			if tag == "-" {
+				continue
+			}
+			idx := append(append([]int(nil), index...), i)
+			if f.Anonymous && !tagged && f.Type.Kind() == reflect.Struct && f.Type != timeType {
+				if err := walk(f.Type, idx); err != nil {
+					return err
+				}
+				continue
+			}
+			if f.PkgPath != "" {
+				// unexported
+				continue
+			}
+			sf := structField{index: idx, column: strings.ToLower(f.Name)}
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				sf.column = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				switch ColumnType(opt) {
+				case "":
+				case "pk":
+					sf.pk = true
+				case TypeString, TypeInt, TypeFloat, TypeBool:
+					sf.typ = ColumnType(opt)
+				default:
+					return fmt.Errorf("field %s: unknown tag option %q", f.Name, opt)
+				}
+			}
+			if sf.typ == "" {
+				typ, err := fieldColumnType(f.Type)
+				if err != nil {
+					return fmt.Errorf("field %s: %v", f.Name, err)
+				}
+				sf.typ = typ
+			}
+			if sf.pk {
+				keys = append(keys, sf)
+			} else {
+				others = append(others, sf)
+			}
+		}
+		return nil
+	}
+	if err := walk(t, nil); err != nil {
+		return nil, err
+	}
+	fields := append(keys, others...)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no stored fields in %v", t)
+	}
+	return fields, nil
+}
+
+// fieldColumnType returns the column type of a field type.
+func fieldColumnType(t reflect.Type) (ColumnType, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return TypeString, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return TypeString, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return TypeInt, nil
+	case reflect.Float32, reflect.Float64:
+		return TypeFloat, nil
+	case reflect.Bool:
+		return TypeBool, nil
+	default:
+		return "", fmt.Errorf("type %v not supported", t)
+	}
+}
+
+// structElemType returns the struct type of the elements of a slice type,
+// whose elements are structs or pointers to structs.
+func structElemType(t reflect.Type) (reflect.Type, bool, error) {
+	if t.Kind() != reflect.Slice {
+		return nil, false, fmt.Errorf("expected a slice of structs, got %v", t)
+	}
+	elem := t.Elem()
+	ptr := elem.Kind() == reflect.Ptr
+	if ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil, false, fmt.Errorf("expected a slice of structs, got %v", t)
+	}
+	return elem, ptr, nil
+}
+
+// WriteStructs writes a slice of structs, or of pointers to structs, one row
+// per element, with the columns and types given by the dfstore tags of the
+// fields. The key fields are the Keys of WriteUpsert when opts.Keys is empty.
+func (dfs DFStore) WriteStructs(ctx context.Context, slice interface{}, opts WriteOptions) error {
+	v := reflect.ValueOf(slice)
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("expected a slice of structs, got %T", slice)
+	}
+	elem, _, err := structElemType(v.Type())
+	if err != nil {
+		return err
+	}
+	fields, err := structFields(elem)
+	if err != nil {
+		return err
+	}
+	header := make([]string, len(fields))
+	types := make(TypeMapping, len(fields))
+	for j, f := range fields {
+		header[j] = f.column
+		types[f.column] = f.typ
+	}
+	if len(opts.Keys) == 0 {
+		for _, f := range fields {
+			if f.pk {
+				opts.Keys = append(opts.Keys, f.column)
+			}
+		}
+	}
+	records := make([][]string, 0, v.Len()+1)
+	records = append(records, header)
+	for i := 0; i < v.Len(); i++ {
+		sv := reflect.Indirect(v.Index(i))
+		if !sv.IsValid() {
+			return fmt.Errorf("element %d is nil", i)
+		}
+		row := make([]string, len(fields))
+		for j, f := range fields {
+			row[j] = formatField(sv.FieldByIndex(f.index))
+		}
+		records = append(records, row)
+	}
+	dfs.opts.Types = mergeTypes(dfs.opts.Types, types)
+	return dfs.WriteRecordsWithOptions(ctx, records, opts)
+}
+
+// formatField formats a field value, nil pointers as empty strings.
+func formatField(fv reflect.Value) string {
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return ""
+		}
+		fv = fv.Elem()
+	}
+	if fv.Type() == timeType {
+		return fv.Interface().(time.Time).Format(time.RFC3339Nano)
+	}
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'g', -1, fv.Type().Bits())
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool())
+	default:
+		return fv.String()
+	}
+}
+
+// ReadInto reads the rows matching the filters into dest, a pointer to a slice
+// of structs or of pointers to structs, whose fields are decoded from the
+// columns given by their dfstore tags. The filters with a comparator select the
+// rows, the filters without comparator are ignored. Missing values leave the
+// fields to their zero value, nil for pointers.
+func (dfs DFStore) ReadInto(ctx context.Context, dest interface{}, filters []dataframe.F, limit int) error {
+	pv := reflect.ValueOf(dest)
+	if pv.Kind() != reflect.Ptr || pv.IsNil() {
+		return fmt.Errorf("expected a pointer to a slice of structs, got %T", dest)
+	}
+	sv := pv.Elem()
+	elem, ptr, err := structElemType(sv.Type())
+	if err != nil {
+		return err
+	}
+	fields, err := structFields(elem)
+	if err != nil {
+		return err
+	}
+	// every column is read once, with its condition if any
+	conditions := make(map[string]dataframe.F)
+	for _, filt := range filters {
+		if filt.Comparator != "" {
+			conditions[filt.Colname] = filt
+		}
+	}
+	types := make(TypeMapping, len(fields))
+	byColumn := make(map[string]structField, len(fields))
+	var read []dataframe.F
+	for _, f := range fields {
+		types[f.column] = f.typ
+		byColumn[f.column] = f
+		filt, ok := conditions[f.column]
+		if !ok {
+			filt = dataframe.F{Colname: f.column}
+		}
+		delete(conditions, f.column)
+		read = append(read, filt)
+	}
+	for _, filt := range filters {
+		if _, ok := conditions[filt.Colname]; ok {
+			read = append(read, filt)
+			delete(conditions, filt.Colname)
+		}
+	}
+	dfs.opts.Types = mergeTypes(dfs.opts.Types, types)
+	records, err := dfs.ReadRecords(ctx, read, limit)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		sv.Set(reflect.MakeSlice(sv.Type(), 0, 0))
+		return nil
+	}
+	out := reflect.MakeSlice(sv.Type(), 0, len(records)-1)
+	for i, row := range records[1:] {
+		item := reflect.New(elem)
+		for j, col := range records[0] {
+			f, ok := byColumn[col]
+			if !ok || j >= len(row) {
+				continue
+			}
+			if err := parseField(item.Elem().FieldByIndex(f.index), row[j]); err != nil {
+				return fmt.Errorf("row %d, column %s: %v", i+1, col, err)
+			}
+		}
+		if ptr {
+			out = reflect.Append(out, item)
+		} else {
+			out = reflect.Append(out, item.Elem())
+		}
+	}
+	sv.Set(out)
+	return nil
+}
+
+// parseField sets a field from a value read, leaving it to its zero value for
+// missing values.
+func parseField(fv reflect.Value, val string) error {
+	if val == "" || val == "<nil>" {
+		if fv.Kind() == reflect.String {
+			fv.SetString("")
+		}
+		return nil
+	}
+	if fv.Kind() == reflect.Ptr {
+		p := reflect.New(fv.Type().Elem())
+		if err := parseField(p.Elem(), val); err != nil {
+			return err
+		}
+		fv.Set(p)
+		return nil
+	}
+	if fv.Type() == timeType {
+		t, err := time.Parse(time.RFC3339Nano, val)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	default:
+		fv.SetString(val)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package dfstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis"
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrTableNotFound is returned by DescribeTable for tables that do not exist.
+var ErrTableNotFound = errors.New("table not found")
+
+// postgresUndefinedTable is the error code of a query on a missing table.
+const postgresUndefinedTable = "42P01"
+
+// ListTables returns the names of the tables of the database, in order. The
+// postgres and redis tables are the ones written by dfstore, which records
+// their columns.
+func (dfs DFStore) ListTables(ctx context.Context) ([]string, error) {
+	dfs.Ctx = ctx
+	var tables []string
+	switch dfs.Kind {
+	case "postgres":
+		if dfs.PostgresClient == nil {
+			return nil, fmt.Errorf("PostgresClient not initialized")
+		}
+		rows, err := dfs.postgresExecer().QueryContext(dfs.Ctx, "SELECT tablename FROM schema ORDER BY tablename")
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == postgresUndefinedTable {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var table string
+			if err := rows.Scan(&table); err != nil {
+				return nil, err
+			}
+			tables = append(tables, table)
+		}
+		return tables, rows.Err()
+	case "mongodb":
+		if dfs.MongodbClient == nil {
+			return nil, fmt.Errorf("MongodbClient not initialized")
+		}
+		names, err := dfs.MongodbClient.Database(dfs.DBName).ListCollectionNames(dfs.Ctx, bson.D{})
+		if err != nil {
+			return nil, err
+		}
+		tables = names
+	case "redis":
+		if dfs.RedisClient == nil {
+			return nil, fmt.Errorf("RedisClient not initialized")
+		}
+		keys, err := dfs.redisScanKeys("schema:*")
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			tables = append(tables, strings.TrimPrefix(key, "schema:"))
+		}
+	default:
+		return nil, fmt.Errorf("not supported: %v", dfs.Kind)
+	}
+	sort.Strings(tables)
+	return tables, nil
+}
+
+// DescribeTable returns the columns and the indexes of a table. The table of the
+// store is used when table is empty. Mongodb collections have no declared
+// columns, their columns are the fields of a document, without _id.
+func (dfs DFStore) DescribeTable(ctx context.Context, table string) (TableSchema, error) {
+	dfs.Ctx = ctx
+	t := dfs.withTable(table)
+	schema := TableSchema{Name: t.TableName}
+	switch dfs.Kind {
+	case "postgres":
+		if dfs.PostgresClient == nil {
+			return schema, fmt.Errorf("PostgresClient not initialized")
+		}
+		var columns string
+		err := dfs.postgresExecer().QueryRowContext(dfs.Ctx, "SELECT columns FROM schema WHERE tablename = $1",
+			t.TableName).Scan(&columns)
+		var pqErr *pq.Error
+		if err == sql.ErrNoRows || errors.As(err, &pqErr) && pqErr.Code == postgresUndefinedTable {
+			return schema, fmt.Errorf("%w: %s", ErrTableNotFound, t.TableName)
+		}
+		if err != nil {
+			return schema, err
+		}
+		schema.Columns = strings.Split(columns, ",")
+	case "mongodb":
+		if dfs.MongodbClient == nil {
+			return schema, fmt.Errorf("MongodbClient not initialized")
+		}
+		var doc bson.D
+		err := dfs.MongodbClient.Database(dfs.DBName).Collection(t.TableName).FindOne(dfs.Ctx, bson.D{}).Decode(&doc)
+		if err == mongo.ErrNoDocuments {
+			return schema, fmt.Errorf("%w: %s", ErrTableNotFound, t.TableName)
+		}
+		if err != nil {
+			return schema, err
+		}
+		for _, e := range doc {
+			if e.Key != "_id" {
+				schema.Columns = append(schema.Columns, e.Key)
+			}
+		}
+	case "redis":
+		if dfs.RedisClient == nil {
+			return schema, fmt.Errorf("RedisClient not initialized")
+		}
+		columns, err := dfs.RedisClient.Get("schema:" + t.TableName).Result()
+		if err == redis.Nil {
+			return schema, fmt.Errorf("%w: %s", ErrTableNotFound, t.TableName)
+		}
+		if err != nil {
+			return schema, err
+		}
+		schema.Columns = strings.Split(columns, ",")
+	default:
+		return schema, fmt.Errorf("not supported: %v", dfs.Kind)
+	}
+	indexes, err := dfs.ListIndexes(ctx, t.TableName)
+	if err != nil {
+		return schema, err
+	}
+	schema.Indexes = indexes
+	return schema, nil
+}
+
+// DropTable deletes a table, its rows, its indexes and its recorded columns.
+// The table of the store is used when table is empty. Missing tables are ignored.
+func (dfs DFStore) DropTable(ctx context.Context, table string) error {
+	dfs.Ctx = ctx
+	t := dfs.withTable(table)
+	switch dfs.Kind {
+	case "postgres":
+		if dfs.PostgresClient == nil {
+			return fmt.Errorf("PostgresClient not initialized")
+		}
+		return dfs.inTransaction(func(tx DFStore) error {
+			qStr := "DROP TABLE IF EXISTS " + t.TableName
+			dfs.debug("postgres drop table", "table", t.TableName, "sql", qStr)
+			if _, err := tx.postgresExecer().ExecContext(dfs.Ctx, qStr); err != nil {
+				return err
+			}
+			// a failed DELETE would abort the transaction, make sure the schema table exists
+			if err := tx.PostgresCreateTable(dfs.Ctx, "schema", postgresSchemaColumns); err != nil {
+				return err
+			}
+			_, err := tx.postgresExecer().ExecContext(dfs.Ctx, "DELETE FROM schema WHERE tablename = $1", t.TableName)
+			return err
+		})
+	case "mongodb":
+		if dfs.MongodbClient == nil {
+			return fmt.Errorf("MongodbClient not initialized")
+		}
+		return dfs.MongodbClient.Database(dfs.DBName).Collection(t.TableName).Drop(dfs.Ctx)
+	case "redis":
+		if dfs.RedisClient == nil {
+			return fmt.Errorf("RedisClient not initialized")
+		}
+		pipe := dfs.RedisClient.TxPipeline()
+		if err := t.redisDropTable(pipe); err != nil {
+			return err
+		}
+		pipe.Del(redisIndexesKey(t.TableName), redisTypesKey(t.TableName), redisJSONPathsKey(t.TableName))
+		return contextDo(dfs.Ctx, func() error {
+			_, err := pipe.Exec()
+			return err
+		})
+	default:
+		return fmt.Errorf("not supported: %v", dfs.Kind)
+	}
+}
@@ -0,0 +1,275 @@
+package dfstore_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dfstore"
+)
+
+// writeCert creates a certificate signed by parent (self signed when parent is nil)
+// and writes it and its key as PEM files named name.crt and name.key in dir.
+func writeCert(t *testing.T, dir, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), crt, 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), keyPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// handshake connects to a server requiring client certificates signed by the CA.
+func handshake(t *testing.T, dir string, client *tls.Config) error {
+	serverCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPem, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caPem)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.(*tls.Conn).Handshake()
+		conn.Close()
+	}()
+	conn, err := tls.Dial("tcp", ln.Addr().String(), client)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// the server reports a rejected client certificate on the first read
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return nil
+	}
+	if err != nil && err.Error() == "EOF" {
+		return nil
+	}
+	return err
+}
+
+func TestTLSOptions(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", true, nil, nil)
+	writeCert(t, dir, "server", false, ca, caKey)
+	writeCert(t, dir, "client", false, ca, caKey)
+	writeCert(t, dir, "other", true, nil, nil)
+
+	opts := dfstore.TLSOptions{
+		CAFile:   filepath.Join(dir, "ca.crt"),
+		CertFile: filepath.Join(dir, "client.crt"),
+		KeyFile:  filepath.Join(dir, "client.key"),
+	}
+	cfg, err := opts.Config("localhost")
+	if err != nil {
+		t.Fatalf("cannot load TLS options, %v", err)
+	}
+	if err := handshake(t, dir, cfg); err != nil {
+		t.Errorf("mutual TLS handshake failed, %v", err)
+	}
+
+	// a server certificate from another CA is rejected
+	pinned := opts
+	pinned.CAFile = filepath.Join(dir, "other.crt")
+	cfg, err = pinned.Config("localhost")
+	if err != nil {
+		t.Fatalf("cannot load TLS options, %v", err)
+	}
+	if err := handshake(t, dir, cfg); err == nil {
+		t.Errorf("expected the server certificate to be rejected")
+	}
+
+	// the server requires a client certificate
+	anonymous := dfstore.TLSOptions{CAFile: opts.CAFile}
+	cfg, err = anonymous.Config("localhost")
+	if err != nil {
+		t.Fatalf("cannot load TLS options, %v", err)
+	}
+	if err := handshake(t, dir, cfg); err == nil {
+		t.Errorf("expected the missing client certificate to be rejected")
+	}
+
+	if _, err := (dfstore.TLSOptions{CAFile: filepath.Join(dir, "missing.crt")}).Config("localhost"); err == nil {
+		t.Errorf("expected error for a missing CA file")
+	}
+}
+
+// tlsServer accepts TLS connections requiring client certificates signed by the
+// CA, after the plain text preamble of the protocol if any, and sends the common
+// name of the client certificate of every completed handshake.
+func tlsServer(t *testing.T, dir string, preamble func(net.Conn) error) (string, <-chan string) {
+	serverCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPem, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caPem)
+	config := &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	clients := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				if preamble != nil && preamble(conn) != nil {
+					return
+				}
+				tc := tls.Server(conn, config)
+				if tc.Handshake() != nil {
+					return
+				}
+				if peers := tc.ConnectionState().PeerCertificates; len(peers) > 0 {
+					select {
+					case clients <- peers[0].Subject.CommonName:
+					default:
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), clients
+}
+
+// postgresSSLRequest accepts the SSLRequest message sent by postgres clients
+// before the TLS handshake.
+func postgresSSLRequest(conn net.Conn) error {
+	if _, err := io.ReadFull(conn, make([]byte, 8)); err != nil {
+		return err
+	}
+	_, err := conn.Write([]byte("S"))
+	return err
+}
+
+func TestTLSConnections(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", true, nil, nil)
+	writeCert(t, dir, "server", false, ca, caKey)
+	writeCert(t, dir, "client", false, ca, caKey)
+	opts := dfstore.TLSOptions{
+		CAFile:   filepath.Join(dir, "ca.crt"),
+		CertFile: filepath.Join(dir, "client.crt"),
+		KeyFile:  filepath.Join(dir, "client.key"),
+	}
+
+	// the servers close the connections after the handshake, so the stores
+	// fail to connect once they have shown the client certificate and
+	// verified the server certificate against the CA
+	for _, tc := range []struct {
+		kind     string
+		url      string
+		preamble func(net.Conn) error
+	}{
+		{"postgres", "postgres://u:p@%s/db/t?connect_timeout=2", postgresSSLRequest},
+		{"redis", "redis://u:p@%s/0/t?dial_timeout=2s", nil},
+		{"mongodb", "mongodb://u:p@%s/db/t?serverSelectionTimeoutMS=1000&directConnection=true", nil},
+	} {
+		addr, clients := tlsServer(t, dir, tc.preamble)
+		URL := strings.Replace(tc.url, "%s", addr, 1)
+		if _, err := dfstore.New(context.TODO(), URL, dfstore.WithTLS(opts)); err == nil {
+			t.Errorf("%s: expected the connection to fail after the handshake", tc.kind)
+		}
+		select {
+		case name := <-clients:
+			if name != "client" {
+				t.Errorf("%s: unexpected client certificate %s", tc.kind, name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: no TLS handshake with the client certificate", tc.kind)
+		}
+	}
+
+	// verify-full without CA file checks the server certificate against the
+	// system pool, which does not hold the test CA
+	addr, clients := tlsServer(t, dir, postgresSSLRequest)
+	system := dfstore.TLSOptions{CertFile: opts.CertFile, KeyFile: opts.KeyFile}
+	_, err := dfstore.New(context.TODO(), "postgres://u:p@"+addr+"/db/t?connect_timeout=2", dfstore.WithTLS(system))
+	if err == nil || !strings.Contains(err.Error(), "unknown authority") {
+		t.Errorf("expected the server certificate to be rejected, got %v", err)
+	}
+	select {
+	case name := <-clients:
+		t.Errorf("unexpected handshake with %s", name)
+	default:
+	}
+}
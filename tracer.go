@@ -0,0 +1,173 @@
+package dfstore
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Tracer starts the spans of the operations of a store. Its methods follow the
+// OpenTelemetry tracer API, so that an adapter to an OpenTelemetry tracer only
+// converts the attributes.
+//
+// Reads have a span named dfstore.read, with child spans for their phases:
+//
+//	dfstore.parse     parsing the query string by dbquery
+//	dfstore.compile   building the backend query, with a query_hash attribute
+//	dfstore.execute   running the query
+//	dfstore.decode    converting the returned rows, fetching the following ones
+//
+// Writes have a dfstore.write span and connections a dfstore.connect span.
+// The spans have backend and table attributes, the operation and decode spans
+// a rows attribute.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is an operation or a phase of an operation.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a key value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr returns an attribute.
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...Attribute) {}
+func (nopSpan) RecordError(error)          {}
+func (nopSpan) End()                       {}
+
+// startSpan starts a span of the table of the store, a child of the span of
+// dfs.Ctx, and returns the store with the context of the span.
+func (dfs DFStore) startSpan(name string, attrs ...Attribute) (DFStore, Span) {
+	tracer := dfs.opts.Tracer
+	if tracer == nil {
+		tracer = nopTracer{}
+	}
+	ctx := dfs.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracer.Start(ctx, name)
+	span.SetAttributes(append([]Attribute{Attr("backend", dfs.Kind), Attr("table", dfs.TableName)}, attrs...)...)
+	dfs.Ctx = ctx
+	return dfs, span
+}
+
+// endSpan ends a span, recording err when it is not nil.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// queryHash returns a short hash of a compiled query, identifying the queries
+// of the same shape and values without recording them in the spans.
+func queryHash(query interface{}) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%v", query)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// InMemoryTracer keeps the spans it starts, to be inspected by tests.
+type InMemoryTracer struct {
+	mu     sync.Mutex
+	nextID uint64
+	spans  []SpanData
+}
+
+// SpanData is a span ended by an InMemoryTracer.
+type SpanData struct {
+	ID uint64
+	// ParentID is the ID of the parent span, 0 for a root span.
+	ParentID   uint64
+	Name       string
+	Attributes map[string]interface{}
+	Err        error
+	Start, End time.Time
+}
+
+type spanKey struct{}
+
+type memSpan struct {
+	tracer *InMemoryTracer
+	data   SpanData
+}
+
+// NewInMemoryTracer returns a tracer keeping its spans in memory.
+func NewInMemoryTracer() *InMemoryTracer {
+	return &InMemoryTracer{}
+}
+
+// Start starts a span, a child of the span of ctx started by the tracer.
+func (t *InMemoryTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	t.nextID++
+	s := &memSpan{tracer: t, data: SpanData{ID: t.nextID, Name: name,
+		Attributes: make(map[string]interface{}), Start: time.Now()}}
+	t.mu.Unlock()
+	if parent, ok := ctx.Value(spanKey{}).(*memSpan); ok && parent.tracer == t {
+		s.data.ParentID = parent.data.ID
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Spans returns the ended spans, in the order they ended.
+func (t *InMemoryTracer) Spans() []SpanData {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]SpanData(nil), t.spans...)
+}
+
+// Reset forgets the ended spans.
+func (t *InMemoryTracer) Reset() {
+	t.mu.Lock()
+	t.spans = nil
+	t.mu.Unlock()
+}
+
+func (s *memSpan) SetAttributes(attrs ...Attribute) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	for _, a := range attrs {
+		s.data.Attributes[a.Key] = a.Value
+	}
+}
+
+func (s *memSpan) RecordError(err error) {
+	s.tracer.mu.Lock()
+	s.data.Err = err
+	s.tracer.mu.Unlock()
+}
+
+func (s *memSpan) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.data.End = time.Now()
+	data := s.data
+	data.Attributes = make(map[string]interface{}, len(s.data.Attributes))
+	for k, v := range s.data.Attributes {
+		data.Attributes[k] = v
+	}
+	s.tracer.spans = append(s.tracer.spans, data)
+}
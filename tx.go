@@ -0,0 +1,232 @@
+package dfstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-redis/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrTransactionsNotSupported is returned by Begin when the backend cannot run
+// transactions, such as a standalone mongodb server.
+var ErrTransactionsNotSupported = errors.New("transactions not supported")
+
+// storeTx holds the backend state of a transaction started by Begin.
+type storeTx struct {
+	sqlTx        *sql.Tx
+	mongoSession mongo.Session
+	mongoCtx     mongo.SessionContext
+	redisPipe    redis.Pipeliner
+	redisTables  map[string]*redisPendingTable
+	done         bool
+}
+
+// redisPendingTable holds the rows of a table written in a redis transaction,
+// which reads do not see before Commit, so that later writes in the
+// transaction find them.
+type redisPendingTable struct {
+	// replaced is set when the table is replaced in the transaction, after
+	// which the stored rows are ignored and row numbers restart from lastID.
+	replaced bool
+	lastID   int64
+	keys     []string
+	// rows holds the values written to each row number.
+	rows map[string]map[string]string
+}
+
+// redisPendingTable returns the pending rows of the table in the transaction,
+// or nil outside a transaction.
+func (dfs DFStore) redisPendingTable() *redisPendingTable {
+	if dfs.tx == nil || dfs.tx.redisPipe == nil {
+		return nil
+	}
+	if dfs.tx.redisTables == nil {
+		dfs.tx.redisTables = make(map[string]*redisPendingTable)
+	}
+	pending, ok := dfs.tx.redisTables[dfs.TableName]
+	if !ok {
+		pending = &redisPendingTable{rows: make(map[string]map[string]string)}
+		dfs.tx.redisTables[dfs.TableName] = pending
+	}
+	return pending
+}
+
+// sqlExecer is implemented by both *sql.DB and *sql.Tx.
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// Begin starts a transaction and returns a copy of the store bound to it. Writes
+// through the returned store take effect together on Commit, or not at all on
+// Rollback. Redis writes are queued in a MULTI block and reads through the returned
+// store do not see them before Commit. The transaction is rolled back when ctx
+// is canceled before Commit: postgres rolls back at once, mongodb and redis,
+// whose writes wait for Commit, when Commit is called, which then fails.
+func (dfs DFStore) Begin(ctx context.Context) (*DFStore, error) {
+	dfs.Ctx = ctx
+	if dfs.tx != nil {
+		return nil, fmt.Errorf("transaction already started")
+	}
+	tx := &storeTx{}
+	switch dfs.Kind {
+	case "redis":
+		if dfs.RedisClient == nil {
+			return nil, fmt.Errorf("RedisClient not initialized")
+		}
+		tx.redisPipe = dfs.RedisClient.TxPipeline()
+	case "postgres":
+		if dfs.PostgresClient == nil {
+			return nil, fmt.Errorf("PostgresClient not initialized")
+		}
+		sqlTx, err := dfs.PostgresClient.BeginTx(dfs.Ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		tx.sqlTx = sqlTx
+	case "mongodb":
+		if dfs.MongodbClient == nil {
+			return nil, fmt.Errorf("MongodbClient not initialized")
+		}
+		ok, err := dfs.mongodbSupportsTransactions()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrTransactionsNotSupported
+		}
+		sess, err := dfs.MongodbClient.StartSession()
+		if err != nil {
+			return nil, err
+		}
+		if err := sess.StartTransaction(); err != nil {
+			sess.EndSession(context.Background())
+			return nil, err
+		}
+		tx.mongoSession = sess
+		tx.mongoCtx = mongo.NewSessionContext(dfs.Ctx, sess)
+	default:
+		return nil, fmt.Errorf("not supported: %v", dfs.Kind)
+	}
+	dfs.tx = tx
+	return &dfs, nil
+}
+
+// Commit applies the writes of the transaction started by Begin.
+func (dfs DFStore) Commit() error {
+	if dfs.tx == nil || dfs.tx.done {
+		return fmt.Errorf("no transaction in progress")
+	}
+	if dfs.tx.sqlTx == nil && dfs.Ctx != nil && dfs.Ctx.Err() != nil {
+		err := dfs.Ctx.Err()
+		if rerr := dfs.Rollback(); rerr != nil {
+			dfs.warn("rollback failed", "kind", dfs.Kind, "error", rerr)
+		}
+		return err
+	}
+	dfs.tx.done = true
+	switch {
+	case dfs.tx.sqlTx != nil:
+		return dfs.tx.sqlTx.Commit()
+	case dfs.tx.mongoSession != nil:
+		defer dfs.tx.mongoSession.EndSession(context.Background())
+		return dfs.tx.mongoSession.CommitTransaction(dfs.tx.mongoCtx)
+	case dfs.tx.redisPipe != nil:
+		defer dfs.tx.redisPipe.Close()
+		_, err := dfs.tx.redisPipe.Exec()
+		return err
+	}
+	return nil
+}
+
+// Rollback discards the writes of the transaction started by Begin.
+func (dfs DFStore) Rollback() error {
+	if dfs.tx == nil || dfs.tx.done {
+		return fmt.Errorf("no transaction in progress")
+	}
+	dfs.tx.done = true
+	switch {
+	case dfs.tx.sqlTx != nil:
+		return dfs.tx.sqlTx.Rollback()
+	case dfs.tx.mongoSession != nil:
+		defer dfs.tx.mongoSession.EndSession(context.Background())
+		// the context of the transaction may be canceled
+		return dfs.tx.mongoSession.AbortTransaction(context.Background())
+	case dfs.tx.redisPipe != nil:
+		defer dfs.tx.redisPipe.Close()
+		return dfs.tx.redisPipe.Discard()
+	}
+	return nil
+}
+
+// inTransaction runs fn with a store bound to a new transaction, committing when
+// fn succeeds and rolling back otherwise. Backends without transactions run fn
+// with the store itself. The errors after which the writes of fn may have taken
+// effect are wrapped in a maybeAppliedError.
+func (dfs DFStore) inTransaction(fn func(DFStore) error) error {
+	if dfs.tx != nil {
+		return fn(dfs)
+	}
+	tx, err := dfs.Begin(dfs.Ctx)
+	if err == ErrTransactionsNotSupported {
+		dfs.debug("write without transaction", "kind", dfs.Kind, "reason", err)
+		return maybeApplied(fn(dfs))
+	}
+	if err != nil {
+		return err
+	}
+	if err := fn(*tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			dfs.warn("rollback failed", "kind", dfs.Kind, "error", rerr)
+		}
+		return err
+	}
+	return maybeApplied(tx.Commit())
+}
+
+// postgresExecer returns the transaction of the store when one is in progress,
+// otherwise the database handle.
+func (dfs DFStore) postgresExecer() sqlExecer {
+	if dfs.tx != nil && dfs.tx.sqlTx != nil {
+		return dfs.tx.sqlTx
+	}
+	return dfs.PostgresClient
+}
+
+// mongoCtx returns the context of the operation joined to the session of the
+// transaction in progress, otherwise dfs.Ctx.
+func (dfs DFStore) mongoCtx() context.Context {
+	if dfs.tx != nil && dfs.tx.mongoSession != nil {
+		return mongo.NewSessionContext(dfs.Ctx, dfs.tx.mongoSession)
+	}
+	return dfs.Ctx
+}
+
+// redisTxPipeline returns the MULTI block of the transaction in progress and false,
+// or a new MULTI block and true when the caller has to execute it.
+func (dfs DFStore) redisTxPipeline() (redis.Pipeliner, bool) {
+	if dfs.tx != nil && dfs.tx.redisPipe != nil {
+		return dfs.tx.redisPipe, false
+	}
+	return dfs.RedisClient.TxPipeline(), true
+}
+
+// mongodbSupportsTransactions reports whether the server is a replica set member
+// or a mongos router, which are required for multi-document transactions.
+func (dfs DFStore) mongodbSupportsTransactions() (bool, error) {
+	var res bson.M
+	err := dfs.MongodbClient.Database("admin").RunCommand(dfs.Ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&res)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := res["setName"]; ok {
+		return true, nil
+	}
+	return res["msg"] == "isdbgrid", nil
+}
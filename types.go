@@ -0,0 +1,72 @@
+package dfstore
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ColumnType is the type of the values of a column.
+type ColumnType string
+
+const (
+	TypeString ColumnType = "string"
+	TypeInt    ColumnType = "int"
+	TypeFloat  ColumnType = "float"
+	TypeBool   ColumnType = "bool"
+)
+
+// TypeMapping maps column names to their types.
+type TypeMapping map[string]ColumnType
+
+// postgresType returns the type of a postgres column.
+func (t ColumnType) postgresType() string {
+	switch t {
+	case TypeInt:
+		return "BIGINT"
+	case TypeFloat:
+		return "DOUBLE PRECISION"
+	case TypeBool:
+		return "BOOLEAN"
+	default:
+		return "VARCHAR(128)"
+	}
+}
+
+// value converts a string to the type of a column, keeping the string when it
+// does not parse. Empty strings are nil in typed columns.
+func (types TypeMapping) value(col, val string) interface{} {
+	t := types[col]
+	if t == "" || t == TypeString {
+		return val
+	}
+	if val == "" {
+		return nil
+	}
+	switch t {
+	case TypeInt:
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return n
+		}
+	case TypeFloat:
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	case TypeBool:
+		if b, err := strconv.ParseBool(strings.ToLower(val)); err == nil {
+			return b
+		}
+	}
+	return val
+}
+
+// mergeTypes returns a new mapping holding the types of all the mappings, the
+// later ones taking precedence.
+func mergeTypes(mappings ...TypeMapping) TypeMapping {
+	types := make(TypeMapping)
+	for _, m := range mappings {
+		for col, t := range m {
+			types[col] = t
+		}
+	}
+	return types
+}
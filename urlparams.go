@@ -0,0 +1,115 @@
+package dfstore
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// urlParams lists the URL query parameters accepted by each backend.
+//
+// postgres:
+//
+//	sslmode          libpq sslmode, disable by default
+//	connect_timeout  seconds to wait for a connection
+//	pool_size        maximum number of open connections
+//	max_idle_conns   maximum number of idle connections
+//	conn_max_lifetime  maximum time a connection is reused, e.g. 30m
+//
+// mongodb: the connection string options of the driver, below, are passed to
+// it, which matches their names without case and checks their values.
+//
+// redis:
+//
+//	dial_timeout, read_timeout, write_timeout  e.g. 5s, or seconds
+//	pool_size        maximum number of connections
+//	tls              true to connect with TLS
+var urlParams = map[string][]string{
+	"postgres": {"sslmode", "connect_timeout", "pool_size", "max_idle_conns", "conn_max_lifetime"},
+	"mongodb": {"appName", "authMechanism", "authMechanismProperties", "authSource", "compressors",
+		"connect", "connectTimeoutMS", "directConnection", "heartbeatFrequencyMS", "heartbeatIntervalMS",
+		"journal", "loadBalanced", "localThresholdMS", "maxConnecting", "maxIdleTimeMS", "maxPoolSize",
+		"maxStaleness", "maxStalenessSeconds", "minPoolSize", "readConcernLevel", "readPreference",
+		"readPreferenceTags", "replicaSet", "retryReads", "retryWrites", "serverSelectionTimeoutMS",
+		"socketTimeoutMS", "srvMaxHosts", "srvServiceName", "ssl", "sslCertificateAuthorityFile",
+		"sslClientCertificateKeyFile", "sslClientCertificateKeyPassword", "sslInsecure", "tls", "tlsCAFile",
+		"tlsCertificateFile", "tlsCertificateKeyFile", "tlsCertificateKeyFilePassword",
+		"tlsDisableOCSPEndpointCheck", "tlsInsecure", "tlsPrivateKeyFile", "w", "wtimeout", "wtimeoutMS",
+		"zlibCompressionLevel", "zstdCompressionLevel"},
+	"redis": {"dial_timeout", "read_timeout", "write_timeout", "pool_size", "tls"},
+}
+
+// parseURLParams parses the query of a store URL and rejects the parameters
+// that the backend does not support.
+func parseURLParams(kind, rawQuery string) (url.Values, error) {
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL query %q, %v", rawQuery, err)
+	}
+	// the mongodb driver matches the names of its options without case
+	fold := func(name string) string { return name }
+	if kind == "mongodb" {
+		fold = strings.ToLower
+	}
+	allowed := make(map[string]bool)
+	for _, name := range urlParams[kind] {
+		allowed[fold(name)] = true
+	}
+	var unknown []string
+	for name := range params {
+		if !allowed[fold(name)] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown URL options %v for %s, supported options are %v", unknown, kind, urlParams[kind])
+	}
+	return params, nil
+}
+
+// paramInt returns the integer value of a parameter, or 0 when it is not set.
+func paramInt(params url.Values, name string) (int, error) {
+	val := params.Get(name)
+	if val == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a non negative integer", name, val)
+	}
+	return n, nil
+}
+
+// paramDuration returns the duration value of a parameter given as a Go duration
+// or a number of seconds, or 0 when it is not set.
+func paramDuration(params url.Values, name string) (time.Duration, error) {
+	val := params.Get(name)
+	if val == "" {
+		return 0, nil
+	}
+	if n, err := strconv.Atoi(val); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q, expected a duration", name, val)
+	}
+	return d, nil
+}
+
+// paramBool returns the boolean value of a parameter, or false when it is not set.
+func paramBool(params url.Values, name string) (bool, error) {
+	val := params.Get(name)
+	if val == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q, expected true or false", name, val)
+	}
+	return b, nil
+}
@@ -0,0 +1,152 @@
+package dfstore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WriteMode selects how WriteRecordsWithOptions treats the records that are
+// already stored in the table.
+type WriteMode int
+
+const (
+	// WriteAppend inserts every record as a new row. This is the mode used by WriteRecords.
+	WriteAppend WriteMode = iota
+	// WriteUpsert replaces the rows whose key columns match and inserts the others.
+	WriteUpsert
+	// WriteReplaceTable removes all existing rows of the table before writing.
+	// The indexes of the table are kept.
+	WriteReplaceTable
+	// WriteErrorIfExists refuses to write into a table that already has records.
+	WriteErrorIfExists
+)
+
+func (m WriteMode) String() string {
+	switch m {
+	case WriteAppend:
+		return "append"
+	case WriteUpsert:
+		return "upsert"
+	case WriteReplaceTable:
+		return "replace-table"
+	case WriteErrorIfExists:
+		return "error-if-exists"
+	default:
+		return fmt.Sprintf("WriteMode(%d)", int(m))
+	}
+}
+
+// ParseWriteMode returns the write mode named by s, as printed by WriteMode.String.
+func ParseWriteMode(s string) (WriteMode, error) {
+	for m := WriteAppend; m <= WriteErrorIfExists; m++ {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return WriteAppend, fmt.Errorf("unknown write mode %q", s)
+}
+
+// DefaultBatchSize is the number of rows sent at a time when WriteOptions.BatchSize is zero.
+const DefaultBatchSize = 1000
+
+// WriteOptions controls a single call to WriteRecordsWithOptions.
+type WriteOptions struct {
+	Mode WriteMode
+	// Keys are the column names identifying a row for WriteUpsert.
+	// The first column of the records is used when Keys is empty.
+	Keys []string
+	// BatchSize is the number of rows per postgres INSERT statement, per mongodb
+	// InsertMany or BulkWrite call and per redis pipeline flush.
+	BatchSize int
+	// Copy loads postgres tables with COPY FROM STDIN instead of INSERT statements.
+	// It does not apply to WriteUpsert.
+	Copy bool
+	// NoTransaction writes without the implicit transaction, so a failure can leave
+	// part of the rows written. Redis pipelines are then flushed every BatchSize
+	// rows instead of being held in one MULTI block, which suits large loads.
+	NoTransaction bool
+}
+
+// batchSize returns the batch size to use, applying the default.
+func (opts WriteOptions) batchSize() int {
+	if opts.BatchSize > 0 {
+		return opts.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+// next returns the options of the batches following the first one of a load
+// split in several writes: the table replaced or checked by the first batch
+// receives the following ones.
+func (opts WriteOptions) next() WriteOptions {
+	if opts.Mode == WriteReplaceTable || opts.Mode == WriteErrorIfExists {
+		opts.Mode = WriteAppend
+	}
+	return opts
+}
+
+// keyIndexes returns the positions of the key columns in the header row.
+func (opts WriteOptions) keyIndexes(cNames []string) ([]int, error) {
+	if len(cNames) < 1 {
+		return nil, fmt.Errorf("not enough columns")
+	}
+	if len(opts.Keys) == 0 {
+		return []int{0}, nil
+	}
+	var idx []int
+	for _, key := range opts.Keys {
+		found := -1
+		for j, cN := range cNames {
+			if cN == key {
+				found = j
+				break
+			}
+		}
+		if found < 0 {
+			return nil, fmt.Errorf("key column %s not found in %v", key, cNames)
+		}
+		idx = append(idx, found)
+	}
+	return idx, nil
+}
+
+// keyColumns returns the names of the key columns in the header row.
+func (opts WriteOptions) keyColumns(cNames []string) ([]string, error) {
+	idx, err := opts.keyIndexes(cNames)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(idx))
+	for i, j := range idx {
+		keys[i] = cNames[j]
+	}
+	return keys, nil
+}
+
+// rowKey joins the key column values of a row into a single identifier.
+func rowKey(row []string, keyIdx []int) string {
+	vals := make([]string, len(keyIdx))
+	for i, j := range keyIdx {
+		vals[i] = row[j]
+	}
+	return strings.Join(vals, "\x1f")
+}
+
+// lastRowPerKey removes the rows whose key columns are repeated by a later row,
+// keeping the order of the remaining rows.
+func lastRowPerKey(rows [][]string, keyIdx []int) [][]string {
+	last := make(map[string]int, len(rows))
+	for i, row := range rows {
+		last[rowKey(row, keyIdx)] = i
+	}
+	if len(last) == len(rows) {
+		return rows
+	}
+	result := make([][]string, 0, len(last))
+	for i, row := range rows {
+		if last[rowKey(row, keyIdx)] == i {
+			result = append(result, row)
+		}
+	}
+	return result
+}